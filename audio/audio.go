@@ -0,0 +1,97 @@
+// Package audio plays drum patterns. A Sequencer steps through patterns,
+// hitting the Instrument of each track, and mixes the instruments'
+// voices into audio through a Mixer.
+package audio
+
+import (
+	"github.com/rubyist/drum/kit"
+	"github.com/rubyist/drum/wav"
+	"time"
+)
+
+// The defaults of a Config.
+const (
+	DefaultRate     = 44100
+	DefaultChannels = 2
+	DefaultBuffer   = 1024
+)
+
+// Config describes the audio a Sequencer makes and how it's played.
+type Config struct {
+	// Device is the name of the sound device played through by the
+	// audio/device package, or "" for the default device.
+	Device string
+
+	// Rate is the number of frames per second.
+	Rate int
+
+	// Channels is the number of interleaved samples in a frame. Mono
+	// plays the left and right channels mixed together, and channels
+	// past the first two are left silent.
+	Channels int
+
+	// Buffer is the number of frames played at a time. Smaller buffers
+	// are heard sooner but are more likely to run dry.
+	Buffer int
+
+	// Latency is the output latency asked of the device, or 0 for the
+	// device's default low latency.
+	Latency time.Duration
+}
+
+// WithDefaults returns c with the defaults in place of its zero fields.
+func (c Config) WithDefaults() Config {
+	if c.Rate <= 0 {
+		c.Rate = DefaultRate
+	}
+	if c.Channels <= 0 {
+		c.Channels = DefaultChannels
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = DefaultBuffer
+	}
+	return c
+}
+
+// Options configure a Sequencer.
+type Options struct {
+	// Config is the audio made by the sequencer, with the defaults in
+	// place of its zero fields.
+	Config Config
+
+	// Kit chooses the instrument of each track. Nil means the samples
+	// named after tracks in the "sounds" directory.
+	Kit *kit.Kit
+
+	// Resample is how samples recorded at other rates are resampled.
+	Resample wav.Quality
+
+	// Missing chooses what plays tracks whose samples can't be loaded.
+	Missing Missing
+
+	// Gain is the master gain of the mix. Zero means DefaultGain.
+	Gain float64
+
+	// Clipping is how the mix is kept within full scale.
+	Clipping Clipping
+
+	// Dither is the bits per sample to dither the output to, or 0 not
+	// to dither it.
+	Dither int
+
+	// Bits is the bits per sample of files written by Render, 16 or 24.
+	// Zero means 16.
+	Bits int
+
+	// Stealing chooses the hit cut short when every voice of an
+	// instrument is playing, unless its kit says otherwise.
+	Stealing Stealing
+
+	// Ramp is the number of steps over which the tempo glides to that
+	// of the next pattern, or 0 to change it at once.
+	Ramp int
+
+	// Swing overrides the patterns' swing when it isn't zero. It is
+	// brought into the range drum.MinSwing to drum.MaxSwing.
+	Swing int
+}
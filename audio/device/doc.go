@@ -0,0 +1,5 @@
+// Package device plays the audio of a Sequencer through a sound device,
+// with portaudio. It is kept apart from the audio package so that only
+// programs playing out loud need portaudio, and is built without it when
+// cgo is disabled, in which case Open always fails.
+package device
@@ -0,0 +1,23 @@
+//go:build !cgo
+
+package device
+
+import (
+	"errors"
+	"github.com/rubyist/drum/audio"
+)
+
+// Output is an audio.Output playing through a sound device.
+type Output struct{}
+
+// Open fails, as sound devices are played through portaudio, which needs
+// cgo.
+func Open(c audio.Config) (*Output, error) {
+	return nil, errors.New("device: built without cgo, so there is no sound device output")
+}
+
+// Write does nothing, as no Output can be opened.
+func (o *Output) Write(samples []int32) error { return nil }
+
+// Close does nothing, as no Output can be opened.
+func (o *Output) Close() error { return nil }
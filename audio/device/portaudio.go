@@ -0,0 +1,132 @@
+//go:build cgo
+
+package device
+
+import (
+	"code.google.com/p/portaudio-go/portaudio"
+	"fmt"
+	"github.com/rubyist/drum/audio"
+	"strings"
+)
+
+// Output is an audio.Output playing through a sound device.
+type Output struct {
+	stream *portaudio.Stream
+	buf    []int32
+	n      int // samples in buf waiting to be written
+}
+
+// Open starts a stream on the device named in c, or the default output
+// device, playing audio with the rate, channels and buffer size of c.
+func Open(c audio.Config) (*Output, error) {
+	c = c.WithDefaults()
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
+	o, err := open(c)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+	return o, nil
+}
+
+func open(c audio.Config) (*Output, error) {
+	dev, err := find(c.Device)
+	if err != nil {
+		return nil, err
+	}
+
+	params := portaudio.LowLatencyParameters(nil, dev)
+	params.Output.Channels = c.Channels
+	if c.Latency > 0 {
+		params.Output.Latency = c.Latency
+	}
+	params.SampleRate = float64(c.Rate)
+	params.FramesPerBuffer = c.Buffer
+
+	o := &Output{buf: make([]int32, c.Buffer*c.Channels)}
+	stream, err := portaudio.OpenStream(params, o.buf)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Start(); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	o.stream = stream
+	return o, nil
+}
+
+// find returns the output device with the given name, ignoring case, or
+// the default output device if name is empty.
+func find(name string) (*portaudio.DeviceInfo, error) {
+	if name == "" {
+		return portaudio.DefaultOutputDevice()
+	}
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, dev := range devices {
+		if dev.MaxOutputChannels == 0 {
+			continue
+		}
+		if strings.EqualFold(dev.Name, name) {
+			return dev, nil
+		}
+		names = append(names, fmt.Sprintf("%q", dev.Name))
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("device: no output device named %q", name)
+	}
+	return nil, fmt.Errorf("device: no output device named %q, there are %s", name, strings.Join(names, ", "))
+}
+
+// Write plays samples, blocking until the device has room for them.
+func (o *Output) Write(samples []int32) error {
+	for len(samples) > 0 {
+		n := copy(o.buf[o.n:], samples)
+		o.n += n
+		samples = samples[n:]
+
+		if o.n == len(o.buf) {
+			if err := o.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush writes the buffer to the device.
+func (o *Output) flush() error {
+	o.n = 0
+	// An underflow is heard as a glitch, but playing goes on
+	if err := o.stream.Write(); err != nil && err != portaudio.OutputUnderflowed {
+		return err
+	}
+	return nil
+}
+
+// Close plays what is left of the buffer, padded with silence, then stops
+// the stream once it has been heard and releases the device.
+func (o *Output) Close() error {
+	var err error
+	if o.n > 0 {
+		for i := o.n; i < len(o.buf); i++ {
+			o.buf[i] = 0
+		}
+		err = o.flush()
+	}
+	if serr := o.stream.Stop(); err == nil {
+		err = serr
+	}
+	if cerr := o.stream.Close(); err == nil {
+		err = cerr
+	}
+	portaudio.Terminate()
+	return err
+}
@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/kit"
+	"github.com/rubyist/drum/synth"
+)
+
+// Missing selects what plays tracks whose samples can't be loaded.
+type Missing int
+
+const (
+	// SynthesizeMissing plays a drum synthesized by the synth package,
+	// chosen by the track's name.
+	SynthesizeMissing Missing = iota
+
+	// SilenceMissing leaves the track silent.
+	SilenceMissing
+
+	// FailMissing makes Add return an error.
+	FailMissing
+)
+
+// String returns the name of m as accepted by Set.
+func (m Missing) String() string {
+	switch m {
+	case SynthesizeMissing:
+		return "synth"
+	case SilenceMissing:
+		return "silence"
+	case FailMissing:
+		return "fail"
+	}
+	return "unknown"
+}
+
+// Set sets m by name, "synth", "silence" or "fail", so that a Missing can
+// be used as a flag.Value.
+func (m *Missing) Set(name string) error {
+	switch name {
+	case "synth":
+		*m = SynthesizeMissing
+	case "silence":
+		*m = SilenceMissing
+	case "fail":
+		*m = FailMissing
+	default:
+		return errors.New("missing samples must be synth, silence or fail")
+	}
+	return nil
+}
+
+// SampleError reports a track whose sample couldn't be loaded, and what
+// plays it instead.
+type SampleError struct {
+	ID         int32
+	Name       string
+	Err        error
+	Substitute string // "a synthesized kick", "silence", or empty if nothing does
+}
+
+func (e *SampleError) Error() string {
+	if e.Substitute == "" {
+		return fmt.Sprintf("track %d (%s): %v", e.ID, e.Name, e.Err)
+	}
+	return fmt.Sprintf("track %d (%s): %v, playing %s instead", e.ID, e.Name, e.Err, e.Substitute)
+}
+
+// Unwrap returns the error loading the sample.
+func (e *SampleError) Unwrap() error {
+	return e.Err
+}
+
+// kindVoices are the synthesized voices that play each kind of drum.
+// Tracks of other kinds are played by claves.
+var kindVoices = map[kit.Kind]string{
+	kit.Kick:      "kick",
+	kit.Snare:     "snare",
+	kit.Clap:      "clap",
+	kit.LowTom:    "low-tom",
+	kit.MidTom:    "mid-tom",
+	kit.HiTom:     "hi-tom",
+	kit.LowConga:  "low-tom",
+	kit.Conga:     "hi-tom",
+	kit.Bongo:     "hi-tom",
+	kit.ClosedHat: "closed-hat",
+	kit.OpenHat:   "open-hat",
+	kit.Crash:     "open-hat",
+	kit.Ride:      "open-hat",
+	kit.Cowbell:   "cowbell",
+	kit.Shaker:    "maracas",
+}
+
+// synthVoice returns the synthesized voice a track is played by.
+func synthVoice(name string) string {
+	if voice, ok := kindVoices[kit.Classify(name)]; ok {
+		return voice
+	}
+	return "claves"
+}
+
+// missingInstrument returns what plays a track whose sample is missing,
+// and a description of it.
+func missingInstrument(t *drum.Track, m Missing, rate int) (*Instrument, string) {
+	if m == SilenceMissing {
+		return NewInstrument(nil, rate), "silence"
+	}
+	voice := synthVoice(t.Name)
+	d, err := synth.New(synth.DefaultParams(voice), rate, 0)
+	if err != nil {
+		// The voices above are all known to the synth package
+		panic(err)
+	}
+	return NewInstrument(Synth{d}, rate), "a synthesized " + voice
+}
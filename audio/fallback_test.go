@@ -0,0 +1,69 @@
+package audio
+
+import (
+	"errors"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/kit"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddMissingSamples(t *testing.T) {
+	pattern, err := drum.DecodeFile(filepath.Join("..", "fixtures", "pattern_4.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSequencer(&Options{Kit: kit.Default(t.TempDir())})
+	warnings, err := s.Add(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a synthesized kick", "a synthesized kick", "a synthesized maracas", "a synthesized low-tom"}
+	if len(warnings) != len(expected) {
+		t.Fatalf("expected %d warnings, got %v", len(expected), warnings)
+	}
+	for i, w := range warnings {
+		var e *SampleError
+		if !errors.As(w, &e) || !errors.Is(w, fs.ErrNotExist) {
+			t.Fatalf("expected a missing file, got %v", w)
+		}
+		if e.Substitute != expected[i] {
+			t.Errorf("%s: expected %s, got %s", e.Name, expected[i], e.Substitute)
+		}
+	}
+
+	// The synthesized voices are heard
+	s.Start()
+	data := make([]int32, 1000*DefaultChannels)
+	s.Read(data)
+	var peak int32
+	for _, v := range data {
+		if v > peak {
+			peak = v
+		}
+	}
+	if peak == 0 {
+		t.Error("expected synthesized voices to be heard")
+	}
+}
+
+func TestAddMissingSamplesPolicy(t *testing.T) {
+	pattern := testPattern(120, 4)
+
+	s := NewSequencer(&Options{Kit: &kit.Kit{}, Missing: SilenceMissing})
+	warnings, err := s.Add(pattern)
+	if err != nil || len(warnings) != 1 || !errors.Is(warnings[0], kit.ErrNoInstrument) {
+		t.Fatalf("expected a warning for the kit having no instrument, got %v %v", warnings, err)
+	}
+	if e := warnings[0].(*SampleError); e.Substitute != "silence" {
+		t.Errorf("expected silence, got %s", e.Substitute)
+	}
+
+	s = NewSequencer(&Options{Kit: &kit.Kit{}, Missing: FailMissing})
+	if _, err := s.Add(pattern); !errors.Is(err, kit.ErrNoInstrument) {
+		t.Errorf("expected the add to fail, got %v", err)
+	}
+}
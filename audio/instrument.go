@@ -0,0 +1,304 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/kit"
+	"github.com/rubyist/drum/synth"
+	"github.com/rubyist/drum/wav"
+	"math"
+	"os"
+)
+
+// Stealing selects which voice an instrument cuts short when it is hit
+// with all of its voices playing.
+type Stealing int
+
+const (
+	// StealOldest cuts short the voice that was hit first.
+	StealOldest Stealing = iota
+
+	// StealQuietest cuts short the voice hit with the lowest velocity,
+	// the oldest of them if several were.
+	StealQuietest
+)
+
+// String returns the name of st as accepted by Set.
+func (st Stealing) String() string {
+	switch st {
+	case StealOldest:
+		return "oldest"
+	case StealQuietest:
+		return "quietest"
+	}
+	return "unknown"
+}
+
+// Set sets st by name, "oldest" or "quietest", so that a Stealing can be
+// used as a flag.Value.
+func (st *Stealing) Set(name string) error {
+	switch name {
+	case "oldest":
+		*st = StealOldest
+	case "quietest":
+		*st = StealQuietest
+	default:
+		return errors.New("voice stealing must be oldest or quietest")
+	}
+	return nil
+}
+
+const (
+	// defaultPolyphony is the number of hits an instrument plays at once
+	// unless told otherwise.
+	defaultPolyphony = 8
+
+	// fadeTime is the length of the fade out given to voices that are
+	// cut short, in seconds. 5ms is too short to hear as a fade but long
+	// enough not to click.
+	fadeTime = 0.005
+)
+
+// Sound is what an instrument plays: a sample, or a synthesized drum.
+// Each hit of the instrument is played by a voice, in which the sound
+// keeps its place.
+type Sound interface {
+	// Start starts v playing the sound from the beginning.
+	Start(v *Voice)
+
+	// Next returns the next frame of the sound playing on v, and false
+	// once it has finished.
+	Next(v *Voice) (left, right float64, ok bool)
+}
+
+// Sample is a Sound of interleaved left and right samples.
+type Sample []float32
+
+// Start starts v playing the sample from its first frame.
+func (s Sample) Start(v *Voice) {
+	v.cursor = 0
+}
+
+// Next returns the frame of the sample v is at, and false once v has
+// played them all.
+func (s Sample) Next(v *Voice) (left, right float64, ok bool) {
+	if v.cursor >= len(s)/2 {
+		return 0, 0, false
+	}
+	left, right = float64(s[v.cursor*2]), float64(s[v.cursor*2+1])
+	v.cursor++
+	return left, right, true
+}
+
+// Synth is a Sound synthesized by the synth package, in mono.
+type Synth struct {
+	*synth.Drum
+}
+
+// Start starts v playing a new hit of the drum.
+func (s Synth) Start(v *Voice) {
+	s.Drum.Start(&v.synth)
+}
+
+// Next returns the next sample of the hit playing on v in both channels,
+// and false once it has died away.
+func (s Synth) Next(v *Voice) (left, right float64, ok bool) {
+	x, ok := s.Drum.Next(&v.synth)
+	return x, x, ok
+}
+
+// Instrument plays a Sound, which is upmixed to stereo if it's in mono.
+// Each hit plays on a Voice of its own, up to the instrument's polyphony.
+type Instrument struct {
+	sound     Sound
+	pan       float64
+	gain      float64
+	polyphony int
+	stealing  Stealing
+	choke     int // instruments in the same group cut each other off, 0 is no group
+	fade      int // frames voices that are cut short fade out over
+
+	voices []Voice
+}
+
+// Voice is one hit of an Instrument, holding the place of its Sound.
+type Voice struct {
+	cursor   int         // the frame of a Sample to play next
+	synth    synth.Voice // the state of a Synth
+	velocity uint8
+	fade     int // frames left of the fade out, 0 if not fading
+}
+
+// newInstrument loads the instrument the kit has for a track, which
+// steals voices as the kit says or else by st.
+func newInstrument(k *kit.Kit, t *drum.Track, q wav.Quality, rate int, st Stealing) (*Instrument, error) {
+	inst, err := k.Lookup(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var i *Instrument
+	if inst.Synth != nil {
+		drum, err := synth.New(*inst.Synth, rate, inst.Tune)
+		if err != nil {
+			return nil, err
+		}
+		i = NewInstrument(Synth{drum}, rate)
+	} else {
+		sample, err := loadSample(inst, q, rate)
+		if err != nil {
+			return nil, err
+		}
+		i = NewInstrument(sample, rate)
+	}
+
+	i.gain = math.Pow(10, inst.Gain/20)
+	i.pan = inst.Pan
+	i.choke = inst.Choke
+	if inst.Voices > 0 {
+		i.setPolyphony(inst.Voices)
+	}
+	i.stealing = st
+	if inst.Steal != "" {
+		if err := i.stealing.Set(inst.Steal); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// loadSample reads an instrument's sample and resamples it to rate.
+func loadSample(inst kit.Instrument, q wav.Quality, rate int) (Sample, error) {
+	sound, err := wav.ReadFile(inst.Sample)
+	if _, ok := err.(*os.PathError); ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", inst.Sample, err)
+	}
+
+	// Tuning plays the sample as though it was recorded at another rate
+	if inst.Tune != 0 {
+		sound.Rate = int(math.Floor(float64(sound.Rate)*math.Pow(2, inst.Tune/12) + 0.5))
+	}
+	sound = sound.Resample(rate, q)
+
+	// Channels past the first two are dropped
+	buffer := make([]float32, sound.Frames()*2)
+	for i := 0; i < sound.Frames(); i++ {
+		left := sound.Samples[i*sound.Channels]
+		right := left
+		if sound.Channels > 1 {
+			right = sound.Samples[i*sound.Channels+1]
+		}
+		buffer[i*2] = left
+		buffer[i*2+1] = right
+	}
+	return buffer, nil
+}
+
+// NewInstrument returns an instrument playing sound at rate frames per
+// second, with the default polyphony and no choke group. A nil sound is
+// silent.
+func NewInstrument(sound Sound, rate int) *Instrument {
+	i := &Instrument{sound: sound, gain: 1, fade: int(math.Max(1, fadeTime*float64(rate)))}
+	i.setPolyphony(defaultPolyphony)
+	return i
+}
+
+// setPolyphony sets the number of voices, which keeps Hit from having
+// to allocate them.
+func (i *Instrument) setPolyphony(n int) {
+	if n < 1 {
+		n = 1
+	}
+	i.polyphony = n
+	if cap(i.voices) < 2*n {
+		// Voices fading out don't count against the polyphony
+		voices := make([]Voice, len(i.voices), 2*n)
+		copy(voices, i.voices)
+		i.voices = voices
+	}
+}
+
+// Read returns the next frame of every voice mixed together, each scaled
+// by the velocity it was hit with, and scaled by the instrument's gain
+// and panned.
+func (i *Instrument) Read() (left, right float64) {
+	playing := i.voices[:0]
+	for n := range i.voices {
+		v := &i.voices[n]
+		l, r, ok := i.sound.Next(v)
+		if !ok {
+			continue
+		}
+
+		gain := float64(v.velocity) / drum.MaxVelocity
+		faded := false
+		if v.fade > 0 {
+			gain *= float64(v.fade) / float64(i.fade)
+			v.fade--
+			faded = v.fade == 0
+		}
+		left += l * gain
+		right += r * gain
+		if !faded {
+			playing = append(playing, *v)
+		}
+	}
+	i.voices = playing
+
+	left *= i.gain * math.Min(1, 1-i.pan)
+	right *= i.gain * math.Min(1, 1+i.pan)
+	return left, right
+}
+
+// Hit starts the sample playing from the beginning on a new voice,
+// scaled by velocity. If every voice is playing, one of them is stolen.
+func (i *Instrument) Hit(velocity uint8) {
+	if i.sound == nil {
+		return
+	}
+
+	steal, active := -1, 0
+	for n, v := range i.voices {
+		if v.fade > 0 {
+			continue
+		}
+		active++
+		// Voices are kept in the order they were hit
+		if steal < 0 || (i.stealing == StealQuietest && v.velocity < i.voices[steal].velocity) {
+			steal = n
+		}
+	}
+	if active >= i.polyphony {
+		i.voices[steal].fade = i.fade
+	}
+
+	// There's only no room for another voice if many have been stolen
+	// and are still fading, in which case the oldest of those goes now.
+	if len(i.voices) == cap(i.voices) {
+		for n, v := range i.voices {
+			if v.fade > 0 {
+				i.voices = append(i.voices[:n], i.voices[n+1:]...)
+				break
+			}
+		}
+	}
+	i.voices = append(i.voices, Voice{velocity: velocity})
+	i.sound.Start(&i.voices[len(i.voices)-1])
+}
+
+// silence stops every voice at once, without fading them out.
+func (i *Instrument) silence() {
+	i.voices = i.voices[:0]
+}
+
+// Choke fades out every voice.
+func (i *Instrument) Choke() {
+	for n := range i.voices {
+		if i.voices[n].fade == 0 {
+			i.voices[n].fade = i.fade
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package audio
+
+import (
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/kit"
+	"github.com/rubyist/drum/wav"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fadeFrames is the length of the fade out at the default rate.
+const fadeFrames = DefaultRate / 200
+
+// ramp returns an instrument whose frames count up from 1, in both
+// channels, so the frames being played can be told from their sum.
+func ramp(frames int) *Instrument {
+	sample := make([]float32, frames*2)
+	for i := 0; i < frames; i++ {
+		sample[i*2], sample[i*2+1] = float32(i+1), float32(i+1)
+	}
+	return NewInstrument(Sample(sample), DefaultRate)
+}
+
+func TestInstrumentVoices(t *testing.T) {
+	i := ramp(10)
+	i.Hit(drum.MaxVelocity)
+	i.Read()
+	i.Read()
+	i.Hit(drum.MaxVelocity)
+
+	// The first hit keeps playing under the second
+	if l, r := i.Read(); l != 3+1 || r != 3+1 {
+		t.Errorf("expected frames 3 and 1 together, got %v %v", l, r)
+	}
+	if len(i.voices) != 2 {
+		t.Errorf("expected 2 voices, got %d", len(i.voices))
+	}
+
+	for n := 0; n < 10; n++ {
+		i.Read()
+	}
+	if len(i.voices) != 0 {
+		t.Errorf("expected the voices to end with the sample, got %d", len(i.voices))
+	}
+}
+
+func TestInstrumentStealing(t *testing.T) {
+	tData := []struct {
+		stealing Stealing
+		stolen   uint8
+	}{
+		{StealOldest, 100},
+		{StealQuietest, 20},
+	}
+
+	for _, exp := range tData {
+		i := ramp(fadeFrames * 4)
+		i.setPolyphony(2)
+		i.stealing = exp.stealing
+
+		i.Hit(100)
+		i.Hit(20)
+		i.Hit(60)
+
+		var fading []Voice
+		for _, v := range i.voices {
+			if v.fade > 0 {
+				fading = append(fading, v)
+			}
+		}
+		if len(i.voices) != 3 || len(fading) != 1 || fading[0].velocity != exp.stolen {
+			t.Errorf("%s: expected the voice hit at %d to fade, got %+v", exp.stealing, exp.stolen, i.voices)
+		}
+
+		// The stolen voice fades out rather than stopping dead
+		for n := 0; n < fadeFrames; n++ {
+			i.Read()
+		}
+		if len(i.voices) != 2 {
+			t.Errorf("%s: expected the stolen voice to be gone after its fade, got %+v", exp.stealing, i.voices)
+		}
+	}
+}
+
+func TestInstrumentFade(t *testing.T) {
+	sample := make(Sample, fadeFrames*4)
+	for n := range sample {
+		sample[n] = 1
+	}
+	i := NewInstrument(sample, DefaultRate)
+	i.Hit(drum.MaxVelocity)
+	i.Choke()
+
+	last := 2.0
+	for n := 0; n < fadeFrames; n++ {
+		l, _ := i.Read()
+		if l >= last || l <= 0 {
+			t.Fatalf("expected a steady fade, got %v after %v", l, last)
+		}
+		last = l
+	}
+	if l, _ := i.Read(); l != 0 {
+		t.Errorf("expected silence after the fade, got %v", l)
+	}
+}
+
+func TestSequencerChoke(t *testing.T) {
+	steps := func(hits ...int) []drum.Step {
+		s := make([]drum.Step, 4)
+		for _, i := range hits {
+			s[i].Velocity = drum.MaxVelocity
+		}
+		return s
+	}
+
+	s := NewSequencer(nil)
+	open, closed, kick := ramp(DefaultRate*4), ramp(DefaultRate*4), ramp(DefaultRate*4)
+	s.commands.push(&command{kind: addCommand, pattern: &drum.Pattern{
+		Tempo:  120,
+		Length: 4,
+		Tracks: []*drum.Track{
+			{ID: 1, Name: "hh-open", Steps: steps(0)},
+			{ID: 2, Name: "hh-close", Steps: steps(1)},
+			{ID: 3, Name: "kick", Steps: steps(0, 1)},
+		},
+	}, instruments: map[trackKey]*Instrument{{1, "hh-open"}: open, {2, "hh-close"}: closed, {3, "kick"}: kick}})
+	s.SetChoke(1, 1)
+	s.SetChoke(2, 1)
+	s.Start()
+
+	// Into the second step, the open hat has been choked by the closed
+	// hat but the kick plays on
+	s.Read(make([]int32, 5600*DefaultChannels))
+	if len(open.voices) != 1 || open.voices[0].fade == 0 {
+		t.Errorf("expected the open hat to be fading, got %+v", open.voices)
+	}
+	if len(kick.voices) != 2 || kick.voices[0].fade != 0 {
+		t.Errorf("expected the kick to play on, got %+v", kick.voices)
+	}
+
+	s.Read(make([]int32, fadeFrames*DefaultChannels))
+	if len(open.voices) != 0 || len(closed.voices) != 1 {
+		t.Errorf("expected only the closed hat, got %+v and %+v", open.voices, closed.voices)
+	}
+}
+
+func TestSynthInstrument(t *testing.T) {
+	k, err := kit.Decode(strings.NewReader(`{"instruments": [
+		{"names": ["cowbell"], "synth": {"voice": "cowbell", "decay": 0.1}, "gain": -6},
+		{"names": ["claves"], "synth": {"voice": "claves"}, "steal": "quietest"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := newInstrument(k, &drum.Track{ID: 1, Name: "cowbell"}, wav.Sinc, DefaultRate, StealOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := i.sound.(Synth); !ok {
+		t.Fatalf("expected a synthesized cowbell, got %T", i.sound)
+	}
+	if i.stealing != StealOldest {
+		t.Errorf("expected the default voice stealing, got %s", i.stealing)
+	}
+	if claves, err := newInstrument(k, &drum.Track{ID: 2, Name: "claves"}, wav.Sinc, DefaultRate, StealOldest); err != nil || claves.stealing != StealQuietest {
+		t.Errorf("expected the kit's voice stealing, got %v %v", claves, err)
+	}
+
+	i.Hit(drum.MaxVelocity)
+	var peak float64
+	frames := 0
+	for len(i.voices) > 0 {
+		l, _ := i.Read()
+		peak = math.Max(peak, math.Abs(l))
+		frames++
+	}
+	if peak == 0 || peak > 0.5 {
+		t.Errorf("expected a peak under -6dB, got %v", peak)
+	}
+	if frames > DefaultRate/4 {
+		t.Errorf("expected a short decay, played for %d frames", frames)
+	}
+}
+
+func TestSequencerSharedIDs(t *testing.T) {
+	k, err := kit.Load(filepath.Join("..", "player", "kit.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSequencer(&Options{Kit: k})
+	for _, name := range []string{"pattern_1.splice", "pattern_3.splice"} {
+		pattern, err := drum.DecodeFile(filepath.Join("..", "fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Add(pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.runCommands()
+
+	// Both patterns have a track 1, a snare in one and a clap in the other
+	snare, clap := s.instruments[trackKey{1, "snare"}], s.instruments[trackKey{1, "clap"}]
+	if snare == nil || clap == nil || snare == clap {
+		t.Fatalf("expected a snare and a clap for track 1, got %v and %v", snare, clap)
+	}
+	if snare.gain != 1 || math.Abs(clap.gain-math.Pow(10, -3.0/20)) > 1e-9 {
+		t.Errorf("expected the snare at 0dB and the clap at -3dB, got gains %v and %v", snare.gain, clap.gain)
+	}
+}
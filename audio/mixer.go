@@ -0,0 +1,141 @@
+package audio
+
+import (
+	"errors"
+	"math"
+)
+
+// Clipping selects how the mix bus keeps its output within full scale.
+type Clipping int
+
+const (
+	// Limit turns the whole mix down as soon as a peak would clip, and
+	// back up over the following 50ms.
+	Limit Clipping = iota
+
+	// SoftClip rounds off peaks above 80% of full scale so that they
+	// approach it without reaching it.
+	SoftClip
+
+	// HardClip cuts off whatever goes past full scale.
+	HardClip
+)
+
+// String returns the name of c as accepted by Set.
+func (c Clipping) String() string {
+	switch c {
+	case Limit:
+		return "limit"
+	case SoftClip:
+		return "soft"
+	case HardClip:
+		return "hard"
+	}
+	return "unknown"
+}
+
+// Set sets c by name, "limit", "soft" or "hard", so that a Clipping can
+// be used as a flag.Value.
+func (c *Clipping) Set(name string) error {
+	switch name {
+	case "limit":
+		*c = Limit
+	case "soft":
+		*c = SoftClip
+	case "hard":
+		*c = HardClip
+	default:
+		return errors.New("clipping must be limit, soft or hard")
+	}
+	return nil
+}
+
+// DefaultGain is the master gain of a Mixer unless set otherwise, which
+// leaves 6dB of headroom for tracks that play together.
+const DefaultGain = 0.5
+
+const (
+	softKnee = 0.8
+
+	// limiterRelease is the time the limiter takes to get most of the
+	// way back to unity gain, in seconds.
+	limiterRelease = 0.05
+)
+
+// Mixer turns the floating point sum of a Sequencer's instruments into
+// output samples. A Sequencer's Mixer is only used by the goroutine
+// calling Read.
+type Mixer struct {
+	Gain     float64
+	Clipping Clipping
+	Dither   int // bits per sample to dither to, or 0 not to dither
+
+	envelope float64 // the limiter's gain
+	release  float64 // how much of the way back to unity the envelope goes each frame
+	noise    uint32  // state of the dither's random numbers
+}
+
+// NewMixer returns a Mixer for audio at rate frames per second, with the
+// default gain, which limits its output and doesn't dither.
+func NewMixer(rate int) *Mixer {
+	return &Mixer{Gain: DefaultGain, envelope: 1, release: 1 / (limiterRelease * float64(rate)), noise: 1}
+}
+
+// reset puts the limiter back at unity gain and starts the dither's
+// random numbers over, so that the same input gives the same output.
+func (m *Mixer) reset() {
+	m.envelope, m.noise = 1, 1
+}
+
+// Output returns a frame of the mix as int32 samples.
+func (m *Mixer) Output(left, right float64) (int32, int32) {
+	left *= m.Gain
+	right *= m.Gain
+
+	switch m.Clipping {
+	case Limit:
+		peak := math.Max(math.Abs(left), math.Abs(right))
+		if peak*m.envelope > 1 {
+			m.envelope = 1 / peak
+		}
+		left *= m.envelope
+		right *= m.envelope
+		m.envelope += (1 - m.envelope) * m.release
+	case SoftClip:
+		left, right = softClip(left), softClip(right)
+	}
+
+	return m.quantize(left), m.quantize(right)
+}
+
+func softClip(v float64) float64 {
+	a := math.Abs(v)
+	if a <= softKnee {
+		return v
+	}
+	a = softKnee + (1-softKnee)*math.Tanh((a-softKnee)/(1-softKnee))
+	return math.Copysign(a, v)
+}
+
+// quantize scales a sample to an int32. When dithering, it's first
+// rounded to the dither's resolution with triangular noise of one step
+// added, which turns the distortion of rounding quiet parts into a
+// constant hiss.
+func (m *Mixer) quantize(v float64) int32 {
+	if m.Dither > 0 && m.Dither < 32 {
+		steps := float64(int64(1) << uint(m.Dither-1))
+		q := math.Floor(v*steps + m.random() - m.random() + 0.5)
+		q = math.Max(-steps, math.Min(q, steps-1))
+		return int32(q) << uint(32-m.Dither)
+	}
+	return int32(math.Max(-1, math.Min(v, 1)) * math.MaxInt32)
+}
+
+// random returns a number from 0 to 1 from an xorshift generator, which
+// is quick and makes renders repeatable.
+func (m *Mixer) random() float64 {
+	m.noise ^= m.noise << 13
+	m.noise ^= m.noise >> 17
+	m.noise ^= m.noise << 5
+	return float64(m.noise) / math.MaxUint32
+}
@@ -0,0 +1,74 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMixerClipping(t *testing.T) {
+	tData := []struct {
+		clipping Clipping
+		in, out  float64
+	}{
+		{HardClip, 0.5, 0.5},
+		{HardClip, 3, 1},
+		{SoftClip, 0.5, 0.5},
+		{SoftClip, -0.8, -0.8},
+		{SoftClip, 1.2, 0.8 + 0.2*math.Tanh(2)},
+		{Limit, 0.5, 0.5},
+		{Limit, 4, 1},
+	}
+
+	for _, exp := range tData {
+		m := NewMixer(DefaultRate)
+		m.Gain = 1
+		m.Clipping = exp.clipping
+		l, r := m.Output(exp.in, -exp.in)
+		if want := int32(exp.out * math.MaxInt32); l != want || r != -want {
+			t.Errorf("%s %v: expected %d, got %d %d", exp.clipping, exp.in, want, l, r)
+		}
+	}
+}
+
+func TestMixerLimiterRelease(t *testing.T) {
+	m := NewMixer(DefaultRate)
+	m.Gain = 1
+	m.Output(2, 0)
+
+	// The peak halves the gain, which then recovers over about 50ms
+	if l, _ := m.Output(0.5, 0); l > math.MaxInt32/4+math.MaxInt32/100 {
+		t.Errorf("expected the limiter to hold the gain down, got %d", l)
+	}
+	for i := 0; i < DefaultRate/4; i++ {
+		m.Output(0.5, 0)
+	}
+	if l, _ := m.Output(0.5, 0); l < math.MaxInt32/2-math.MaxInt32/100 {
+		t.Errorf("expected the limiter to release, got %d", l)
+	}
+}
+
+func TestMixerDither(t *testing.T) {
+	m := NewMixer(DefaultRate)
+	m.Gain = 1
+	m.Clipping = HardClip
+	m.Dither = 16
+
+	// A level between two 16 bit steps comes out as either of them,
+	// averaging out to the level
+	const level = 100.25 / 32768
+	var sum float64
+	for i := 0; i < 10000; i++ {
+		l, _ := m.Output(level, 0)
+		if l&0xffff != 0 {
+			t.Fatalf("expected 16 bit samples, got %x", l)
+		}
+		v := float64(l>>16) / 32768
+		if math.Abs(v-level) > 2.0/32768 {
+			t.Fatalf("expected dither within two steps, got %v", v*32768)
+		}
+		sum += v
+	}
+	if avg := sum / 10000; math.Abs(avg-level) > 0.1/32768 {
+		t.Errorf("expected an average of %v, got %v", level*32768, avg*32768)
+	}
+}
@@ -0,0 +1,196 @@
+package audio
+
+import (
+	"errors"
+	"github.com/rubyist/drum/wav"
+	"io"
+	"os"
+)
+
+// Output is where the audio of a Sequencer goes, played by Sequencer.Play.
+type Output interface {
+	// Write plays interleaved samples scaled to the full range of an
+	// int32, as returned by Sequencer.Read. Outputs playing in real time
+	// block until there is room for them.
+	Write(samples []int32) error
+
+	// Close finishes the output once nothing more will be written.
+	Close() error
+}
+
+// Sink selects the kind of Output the commands play through.
+type Sink int
+
+const (
+	// DeviceSink plays through the sound device, with the audio/device
+	// package.
+	DeviceSink Sink = iota
+
+	// NullSink throws the audio away, as fast as it is made.
+	NullSink
+
+	// WAVSink writes a WAVE file.
+	WAVSink
+
+	// PCMSink writes raw little endian PCM samples, for aplay or sox.
+	PCMSink
+)
+
+// String returns the name of s as accepted by Set.
+func (s Sink) String() string {
+	switch s {
+	case DeviceSink:
+		return "device"
+	case NullSink:
+		return "null"
+	case WAVSink:
+		return "wav"
+	case PCMSink:
+		return "pcm"
+	}
+	return "unknown"
+}
+
+// Set sets s by name, "device", "null", "wav" or "pcm", so that a Sink
+// can be used as a flag.Value.
+func (s *Sink) Set(name string) error {
+	switch name {
+	case "device":
+		*s = DeviceSink
+	case "null":
+		*s = NullSink
+	case "wav":
+		*s = WAVSink
+	case "pcm":
+		*s = PCMSink
+	default:
+		return errors.New("output must be device, null, wav or pcm")
+	}
+	return nil
+}
+
+// OpenOutput opens an Output of a sink other than DeviceSink, which needs
+// the audio/device package, for the audio described by c. WAV files are
+// written to path, and PCM to path or, if it is empty or "-", to standard
+// output. Both have the given bits per sample, 16 or 24.
+func OpenOutput(s Sink, c Config, path string, bits int) (Output, error) {
+	c = c.WithDefaults()
+	if (s == WAVSink || s == PCMSink) && bits != 16 && bits != 24 {
+		return nil, errBits
+	}
+
+	switch s {
+	case NullSink:
+		return Null, nil
+	case WAVSink:
+		return CreateWAV(path, c.Rate, c.Channels, bits)
+	case PCMSink:
+		if path == "" || path == "-" {
+			return NewPCM(nopCloser{os.Stdout}, bits)
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewPCM(file, bits)
+	}
+	return nil, errors.New("audio: " + s.String() + " output can't be opened by the audio package")
+}
+
+var errBits = errors.New("audio: bits per sample must be 16 or 24")
+
+// Null is an Output that throws away what is written to it.
+var Null Output = null{}
+
+type null struct{}
+
+func (null) Write(samples []int32) error { return nil }
+func (null) Close() error                { return nil }
+
+// WAV is an Output writing a WAVE file.
+type WAV struct {
+	file *os.File
+	w    *wav.Writer
+}
+
+// CreateWAV creates a WAVE file at path with the given sample rate,
+// number of channels and bits per sample, 16 or 24.
+func CreateWAV(path string, rate, channels, bits int) (*WAV, error) {
+	if bits != 16 && bits != 24 {
+		return nil, errBits
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := wav.NewWriter(file, rate, channels, bits)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &WAV{file: file, w: w}, nil
+}
+
+// Write writes samples to the file.
+func (o *WAV) Write(samples []int32) error {
+	return o.w.WriteInt32(samples)
+}
+
+// Close fills in the file's header and closes it.
+func (o *WAV) Close() error {
+	if err := o.w.Close(); err != nil {
+		o.file.Close()
+		return err
+	}
+	return o.file.Close()
+}
+
+// PCM is an Output writing raw, headerless samples.
+type PCM struct {
+	w    io.WriteCloser
+	bits int
+	buf  []byte
+}
+
+// NewPCM returns an Output writing signed little endian samples with the
+// given bits per sample, 16 or 24, to w. Closing it closes w.
+func NewPCM(w io.WriteCloser, bits int) (*PCM, error) {
+	if bits != 16 && bits != 24 {
+		return nil, errBits
+	}
+	return &PCM{w: w, bits: bits}, nil
+}
+
+// Write writes samples, keeping their most significant bits.
+func (o *PCM) Write(samples []int32) error {
+	size := o.bits / 8
+	if cap(o.buf) < len(samples)*size {
+		o.buf = make([]byte, len(samples)*size)
+	}
+	buf := o.buf[:len(samples)*size]
+
+	for i, s := range samples {
+		b := buf[i*size:]
+		switch o.bits {
+		case 16:
+			b[0], b[1] = byte(s>>16), byte(s>>24)
+		case 24:
+			b[0], b[1], b[2] = byte(s>>8), byte(s>>16), byte(s>>24)
+		}
+	}
+	_, err := o.w.Write(buf)
+	return err
+}
+
+// Close closes the underlying writer.
+func (o *PCM) Close() error {
+	return o.w.Close()
+}
+
+// nopCloser keeps standard output open when its Output is closed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
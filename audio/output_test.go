@@ -0,0 +1,137 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/rubyist/drum"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlayPCM(t *testing.T) {
+	var buf bytes.Buffer
+	out, err := NewPCM(nopCloser{&buf}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSequencer(nil)
+	add(s, testPattern(120, 4))
+	s.Start()
+	if err := s.Play(context.Background(), out, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two loops of four steps of 5512.5 frames
+	if buf.Len() != 44100*DefaultChannels*2 {
+		t.Fatalf("expected 44100 frames, got %d bytes", buf.Len())
+	}
+
+	r := NewSequencer(nil)
+	add(r, testPattern(120, 4))
+	r.Start()
+	expected := make([]int32, 44100*DefaultChannels)
+	r.Read(expected)
+	for i, v := range expected {
+		if got := int16(binary.LittleEndian.Uint16(buf.Bytes()[i*2:])); got != int16(v>>16) {
+			t.Fatalf("sample %d: expected %d, got %d", i, v>>16, got)
+		}
+	}
+}
+
+func TestSink(t *testing.T) {
+	for _, name := range []string{"device", "null", "wav", "pcm"} {
+		var s Sink
+		if err := s.Set(name); err != nil || s.String() != name {
+			t.Errorf("%s: got %s %v", name, s, err)
+		}
+	}
+	if _, err := OpenOutput(DeviceSink, Config{}, "", 16); err == nil {
+		t.Error("expected the device to need the device package")
+	}
+}
+
+func BenchmarkPlay(b *testing.B) {
+	s := NewSequencer(nil)
+	p := testPattern(120, 16)
+	for i := range p.Tracks[0].Steps {
+		p.Tracks[0].Steps[i].Velocity = drum.MaxVelocity
+	}
+	s.commands.push(&command{kind: addCommand, pattern: p, instruments: map[trackKey]*Instrument{{1, "kick"}: ramp(44100)}})
+	s.Start()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Play(context.Background(), Null, 1)
+	}
+}
+
+func TestPlayCancel(t *testing.T) {
+	s := NewSequencer(nil)
+	add(s, testPattern(120, 4))
+	s.Start()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	played := make(chan error)
+	go func() {
+		played <- s.Play(ctx, Null, 0)
+	}()
+	cancel()
+	if err := <-played; err != context.Canceled {
+		t.Errorf("expected playing to be canceled, got %v", err)
+	}
+}
+
+func TestOpenOutputBits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.pcm")
+	for _, sink := range []Sink{WAVSink, PCMSink} {
+		if _, err := OpenOutput(sink, Config{}, path, 12); err == nil {
+			t.Errorf("%s: expected 12 bits per sample to be refused", sink)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no file to be left, got %v", sink, err)
+		}
+	}
+}
+
+func TestRenderTwice(t *testing.T) {
+	s := NewSequencer(&Options{Dither: 16})
+	p := testPattern(120, 4)
+
+	// A sample longer than the pattern, which is still ringing at its end
+	sample := make(Sample, 30000*2)
+	for i := range sample {
+		sample[i] = 0.5
+	}
+	instruments := map[trackKey]*Instrument{keyOf(p.Tracks[0]): NewInstrument(sample, DefaultRate)}
+	s.commands.push(&command{kind: addCommand, pattern: p, instruments: instruments})
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.wav"), filepath.Join(dir, "second.wav")
+	if err := s.Render(first, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Playing leaves voices ringing, which aren't heard in the next render
+	s.Start()
+	if err := s.Play(context.Background(), Null, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Render(second, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("expected the same patterns to render to the same file")
+	}
+}
@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// Play reads the sequence and writes it to out, a buffer of the
+// Config's size at a time, until the patterns have been played through
+// loops times or, if loops is 0, until ctx is done or writing fails. It
+// returns ctx's error if it is done first, and doesn't close out, which
+// is safe to close once Play has returned. The length of a loop is that
+// of the patterns at their own tempos, or at the tempo given to SetTempo,
+// without any ramps between them.
+//
+// Play reads from the sequencer itself, so only one goroutine may play a
+// sequencer at a time.
+func (s *Sequencer) Play(ctx context.Context, out Output, loops int) error {
+	s.runCommands()
+
+	frames := -1
+	if loops > 0 {
+		if len(s.patterns) == 0 {
+			return errors.New("no patterns to play")
+		}
+		var length float64
+		for _, p := range s.patterns {
+			length += float64(p.StepCount()) * s.stepFrames(p)
+		}
+		if length <= 0 || math.IsInf(length, 0) || math.IsNaN(length) {
+			return errors.New("patterns have no length at their tempo")
+		}
+		frames = int(math.Ceil(length * float64(loops)))
+	}
+
+	channels := s.config.Channels
+	buf := make([]int32, s.config.Buffer*channels)
+	for frames != 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := s.config.Buffer
+		if frames > 0 && n > frames {
+			n = frames
+		}
+		s.Read(buf[:n*channels])
+		if err := out.Write(buf[:n*channels]); err != nil {
+			return err
+		}
+		if frames > 0 {
+			frames -= n
+		}
+	}
+	return nil
+}
+
+// Render plays the sequence through loops times from the start and writes
+// the audio to a WAVE file at path, with the bits per sample of
+// Options.Bits. No audio device is needed and, as steps are timed by the
+// frames read, the same patterns always render to the same file.
+func (s *Sequencer) Render(path string, loops int) error {
+	s.Reset()
+	s.Start()
+	defer s.Stop()
+	s.runCommands()
+
+	if len(s.patterns) == 0 {
+		return errors.New("no patterns to render")
+	}
+
+	out, err := CreateWAV(path, s.config.Rate, s.config.Channels, s.bits)
+	if err != nil {
+		return err
+	}
+	if err := s.Play(context.Background(), out, loops); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
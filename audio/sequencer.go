@@ -0,0 +1,588 @@
+package audio
+
+import (
+	"fmt"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/kit"
+	"github.com/rubyist/drum/wav"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Sequencer takes a sequence of Pattern objects and provides
+// audio data necessary to play the patterns. Sequencer loops
+// the patterns in order until Stop() is called.
+//
+// Everything the sequencer plays is owned by the goroutine calling
+// Read, normally through Play. Other goroutines control it with
+// commands, which are queued without locking and carried out at the
+// start of the next Read, and follow it through the Events channel.
+type Sequencer struct {
+	commands queue
+	events   chan Event
+	config   Config
+	bits     int // of files written by Render
+
+	// Only touched by Add
+	mu      sync.Mutex
+	kit     *kit.Kit
+	quality wav.Quality
+	missing Missing
+	steal   Stealing
+	loaded  map[trackKey]bool
+
+	// Only touched by Read
+	patterns    []*drum.Pattern
+	instruments map[trackKey]*Instrument
+	mixer       *Mixer
+	pattern     int
+	step        int
+	running     bool
+	tempo       float64 // overrides the patterns' tempo when set
+	swing       int     // overrides the patterns' swing when set
+	untilStep   float64 // frames until the next step is played
+
+	// The tempo in BPM of the step playing, 0 before the first, and the
+	// ramp it's on when changing
+	bpm      float64
+	ramp     int // steps a change of tempo is ramped over
+	rampFrom float64
+	rampTo   float64
+	rampLeft int
+}
+
+// trackKey identifies the instrument of a track. Patterns reuse IDs for
+// different drums, and kits look tracks up by name as well as ID, so
+// both are needed to tell which instrument a track plays.
+type trackKey struct {
+	ID   int32
+	Name string
+}
+
+func keyOf(t *drum.Track) trackKey {
+	return trackKey{ID: t.ID, Name: t.Name}
+}
+
+// EventKind identifies what an Event reports.
+type EventKind int
+
+const (
+	// StepChanged is sent when a step is played.
+	StepChanged EventKind = iota
+
+	// PatternChanged is sent when a different pattern starts playing,
+	// or the sequence of patterns changes.
+	PatternChanged
+
+	// StateChanged is sent when the sequencer starts or stops.
+	StateChanged
+)
+
+// Event describes a change in the sequencer, along with where it is.
+type Event struct {
+	Kind     EventKind
+	Pattern  int     // index of the pattern playing
+	Step     int     // the step last played in that pattern
+	Patterns int     // the number of patterns in the sequence
+	Running  bool    // whether the sequencer is running
+	Tempo    float64 // the tempo of that step in BPM, 0 before the first
+}
+
+// NewSequencer creates a new Sequencer object. A nil opts uses the
+// defaults of Options.
+func NewSequencer(opts *Options) *Sequencer {
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := &Sequencer{
+		kit:         opts.Kit,
+		quality:     opts.Resample,
+		missing:     opts.Missing,
+		steal:       opts.Stealing,
+		config:      opts.Config.WithDefaults(),
+		bits:        opts.Bits,
+		ramp:        opts.Ramp,
+		swing:       clampSwing(opts.Swing),
+		events:      make(chan Event, 64),
+		loaded:      make(map[trackKey]bool),
+		instruments: make(map[trackKey]*Instrument),
+	}
+	s.mixer = NewMixer(s.config.Rate)
+	if s.kit == nil {
+		s.kit = kit.Default("sounds")
+	}
+	if s.bits == 0 {
+		s.bits = 16
+	}
+	if opts.Gain != 0 {
+		s.mixer.Gain = opts.Gain
+	}
+	s.mixer.Clipping = opts.Clipping
+	s.mixer.Dither = opts.Dither
+	s.commands.init()
+	return s
+}
+
+// Config returns the audio made by the sequencer, which outputs should
+// be opened with.
+func (s *Sequencer) Config() Config {
+	return s.config
+}
+
+// Add adds a Pattern to the sequence. The pattern's samples are loaded
+// by the caller; the pattern is added to the sequence by the next Read.
+//
+// Tracks whose samples can't be loaded are played as chosen by
+// Options.Missing, and reported by a *SampleError in the warnings returned.
+// If missing samples are set to fail, the *SampleError is returned as
+// the error instead and the pattern isn't added. Patterns whose tempo
+// isn't a positive number of beats per minute can't be played, and are
+// refused with an error.
+func (s *Sequencer) Add(p *drum.Pattern) ([]error, error) {
+	if tempo := float64(p.Tempo); tempo <= 0 || math.IsInf(tempo, 0) || math.IsNaN(tempo) {
+		return nil, fmt.Errorf("audio: can't play a pattern at a tempo of %v BPM", p.Tempo)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var warnings []error
+	instruments := make(map[trackKey]*Instrument)
+	for _, track := range p.Tracks {
+		if _, ok := instruments[keyOf(track)]; ok || s.loaded[keyOf(track)] {
+			continue
+		}
+		instrument, err := newInstrument(s.kit, track, s.quality, s.config.Rate, s.steal)
+		if err != nil {
+			e := &SampleError{ID: track.ID, Name: track.Name, Err: err}
+			if s.missing == FailMissing {
+				return nil, e
+			}
+			instrument, e.Substitute = missingInstrument(track, s.missing, s.config.Rate)
+			instrument.stealing = s.steal
+			warnings = append(warnings, e)
+		}
+		instruments[keyOf(track)] = instrument
+	}
+	for key := range instruments {
+		s.loaded[key] = true
+	}
+
+	s.commands.push(&command{kind: addCommand, pattern: p, instruments: instruments})
+	return warnings, nil
+}
+
+// Start starts the sequencer. Once the sequencer starts, audio
+// data will be available via Read.
+func (s *Sequencer) Start() {
+	s.commands.push(&command{kind: startCommand})
+}
+
+// Stop stops the sequencer from running.
+func (s *Sequencer) Stop() {
+	s.commands.push(&command{kind: stopCommand})
+}
+
+// Reset stops the sequencer, silences every instrument and moves it
+// back to the first step of the first pattern.
+func (s *Sequencer) Reset() {
+	s.commands.push(&command{kind: resetCommand})
+}
+
+// Seek moves the sequencer to a step of a pattern, which is the next
+// to be played.
+func (s *Sequencer) Seek(pattern, step int) {
+	s.commands.push(&command{kind: seekCommand, index: pattern, step: step})
+}
+
+// SetTempo plays every pattern at bpm rather than its own tempo. A bpm
+// of zero goes back to the patterns' tempos. The change is ramped like
+// any other, from the next step.
+func (s *Sequencer) SetTempo(bpm float64) {
+	s.commands.push(&command{kind: tempoCommand, value: bpm})
+}
+
+// SetTempoRamp glides the tempo over the given number of steps when it
+// changes, as it does between patterns of different tempos, rather than
+// jumping to the new tempo. A ramp of 0 steps changes it at once.
+func (s *Sequencer) SetTempoRamp(steps int) {
+	s.commands.push(&command{kind: rampCommand, index: steps})
+}
+
+// SetSwing plays every pattern swung by percent, from drum.MinSwing to
+// drum.MaxSwing, rather than by its own swing. A percent of zero goes
+// back to the patterns' swing.
+func (s *Sequencer) SetSwing(percent int) {
+	s.commands.push(&command{kind: swingCommand, index: clampSwing(percent)})
+}
+
+// clampSwing brings a swing other than zero into the range of swings.
+func clampSwing(percent int) int {
+	if percent == 0 {
+		return 0
+	}
+	return max(drum.MinSwing, min(percent, drum.MaxSwing))
+}
+
+// SetPan places a track's instrument between the left and right channels,
+// from -1 for hard left to 1 for hard right. Panning a track silences the
+// opposite channel in proportion, so a centered track plays at full level
+// in both. Like the other settings of a track, it applies to every track
+// with the ID already added, whichever pattern it's in. Tracks of
+// patterns added later start from the kit's settings.
+func (s *Sequencer) SetPan(id int32, pan float64) {
+	s.commands.push(&command{kind: panCommand, id: id, value: math.Max(-1, math.Min(pan, 1))})
+}
+
+// SetGain scales a track's instrument by gain, 1 leaving it as sampled.
+func (s *Sequencer) SetGain(id int32, gain float64) {
+	s.commands.push(&command{kind: gainCommand, id: id, value: gain})
+}
+
+// SetPolyphony sets the number of hits of a track's instrument that can
+// play at once, and which is cut short when it's hit again with all of
+// them playing.
+func (s *Sequencer) SetPolyphony(id int32, voices int, stealing Stealing) {
+	s.commands.push(&command{kind: polyphonyCommand, id: id, index: voices, stealing: stealing})
+}
+
+// SetChoke puts a track's instrument in a choke group. Hitting any
+// instrument in a group cuts off the others in it, as closing a hi-hat
+// cuts off an open one. Group 0 is no group.
+func (s *Sequencer) SetChoke(id int32, group int) {
+	s.commands.push(&command{kind: chokeCommand, id: id, index: group})
+}
+
+// SetMasterGain scales the whole mix by gain before it is clipped. It
+// starts at 0.5, leaving 6dB of headroom.
+func (s *Sequencer) SetMasterGain(gain float64) {
+	s.commands.push(&command{kind: masterGainCommand, value: gain})
+}
+
+// SetClipping chooses how the mix is kept within full scale.
+func (s *Sequencer) SetClipping(c Clipping) {
+	s.commands.push(&command{kind: clippingCommand, index: int(c)})
+}
+
+// SetDither dithers the output to the given bits per sample, usually
+// 16 when the output will be stored as 16 bit. Zero turns dithering off.
+func (s *Sequencer) SetDither(bits int) {
+	s.commands.push(&command{kind: ditherCommand, index: bits})
+}
+
+// Events returns the channel on which the sequencer reports changes.
+// Events are dropped rather than holding up the audio when the channel
+// is full, but each one says where the sequencer is, so the latest
+// event received is always accurate.
+func (s *Sequencer) Events() <-chan Event {
+	return s.events
+}
+
+// Read fills a data buffer with audio data. While the sequencer is
+// running, steps are played as the frames they fall on are read.
+func (s *Sequencer) Read(data []int32) {
+	s.runCommands()
+
+	if len(s.patterns) == 0 {
+		for i := range data {
+			data[i] = 0
+		}
+		return
+	}
+
+	channels := s.config.Channels
+	for i := 0; i < len(data); i += channels {
+		if s.running {
+			if s.untilStep <= 0 {
+				s.untilStep += s.nextStepFrames()
+				s.advance()
+			}
+			s.untilStep--
+		}
+
+		var left, right float64
+		for _, instrument := range s.instruments {
+			l, r := instrument.Read()
+			left += l
+			right += r
+		}
+		if channels == 1 {
+			left = (left + right) / 2
+		}
+		l, r := s.mixer.Output(left, right)
+
+		frame := data[i:]
+		if len(frame) > channels {
+			frame = frame[:channels]
+		}
+		for c := range frame {
+			switch c {
+			case 0:
+				frame[c] = l
+			case 1:
+				frame[c] = r
+			default:
+				frame[c] = 0
+			}
+		}
+	}
+}
+
+// runCommands carries out the commands queued since the last Read.
+func (s *Sequencer) runCommands() {
+	for c := s.commands.pop(); c != nil; c = s.commands.pop() {
+		switch c.kind {
+		case addCommand:
+			s.patterns = append(s.patterns, c.pattern)
+			for key, instrument := range c.instruments {
+				s.instruments[key] = instrument
+			}
+			s.notify(PatternChanged)
+		case startCommand:
+			if !s.running && len(s.patterns) > 0 {
+				s.running = true
+				s.untilStep = 0
+				s.notify(StateChanged)
+			}
+		case stopCommand:
+			if s.running {
+				s.running = false
+				s.notify(StateChanged)
+			}
+		case resetCommand:
+			s.running = false
+			s.pattern, s.step = 0, 0
+			s.untilStep = 0
+			s.bpm, s.rampLeft = 0, 0
+			for _, instrument := range s.instruments {
+				instrument.silence()
+			}
+			s.mixer.reset()
+			s.notify(StateChanged)
+		case seekCommand:
+			if c.index >= 0 && c.index < len(s.patterns) && c.step >= 0 && c.step < s.patterns[c.index].StepCount() {
+				changed := c.index != s.pattern
+				s.pattern, s.step = c.index, c.step
+				s.untilStep = 0
+				if changed {
+					s.notify(PatternChanged)
+				}
+			}
+		case tempoCommand:
+			s.tempo = c.value
+		case swingCommand:
+			s.swing = c.index
+		case rampCommand:
+			s.ramp = c.index
+			if s.rampLeft > s.ramp {
+				s.rampLeft = s.ramp
+			}
+		case panCommand:
+			for _, instrument := range s.tracks(c.id) {
+				instrument.pan = c.value
+			}
+		case gainCommand:
+			for _, instrument := range s.tracks(c.id) {
+				instrument.gain = c.value
+			}
+		case polyphonyCommand:
+			for _, instrument := range s.tracks(c.id) {
+				instrument.setPolyphony(c.index)
+				instrument.stealing = c.stealing
+			}
+		case chokeCommand:
+			for _, instrument := range s.tracks(c.id) {
+				instrument.choke = c.index
+			}
+		case masterGainCommand:
+			s.mixer.Gain = c.value
+		case clippingCommand:
+			s.mixer.Clipping = Clipping(c.index)
+		case ditherCommand:
+			s.mixer.Dither = c.index
+		}
+	}
+}
+
+// notify sends an event without waiting for it to be received.
+func (s *Sequencer) notify(kind EventKind) {
+	e := Event{
+		Kind:     kind,
+		Pattern:  s.pattern,
+		Step:     s.step,
+		Patterns: len(s.patterns),
+		Running:  s.running,
+		Tempo:    s.bpm,
+	}
+	select {
+	case s.events <- e:
+	default:
+	}
+}
+
+// patternTempo returns the tempo a pattern is played at, in BPM.
+func (s *Sequencer) patternTempo(p *drum.Pattern) float64 {
+	if s.tempo > 0 {
+		return s.tempo
+	}
+	return float64(p.Tempo)
+}
+
+// stepFrames returns the number of frames, usually fractional, that
+// each step of the pattern lasts at its tempo.
+func (s *Sequencer) stepFrames(p *drum.Pattern) float64 {
+	return float64(s.config.Rate) * 60 / (s.patternTempo(p) * float64(p.BeatSize()))
+}
+
+// nextStepFrames moves the tempo a step along any ramp towards that of
+// the pattern playing, and returns the number of frames the next step
+// lasts. Swung steps are played in pairs within each beat, the first
+// lengthened by as much as the second, which is delayed, is shortened.
+func (s *Sequencer) nextStepFrames() float64 {
+	p := s.patterns[s.pattern]
+	target := s.patternTempo(p)
+
+	switch {
+	case s.bpm == 0 || s.ramp <= 0:
+		s.bpm, s.rampTo, s.rampLeft = target, target, 0
+	case target != s.rampTo:
+		// Ramps start from wherever the tempo is, even partway through
+		// another ramp
+		s.rampFrom, s.rampTo, s.rampLeft = s.bpm, target, s.ramp
+		fallthrough
+	default:
+		if s.rampLeft > 0 {
+			s.rampLeft--
+		}
+		s.bpm = target + (s.rampFrom-target)*float64(s.rampLeft)/float64(s.ramp)
+	}
+	frames := float64(s.config.Rate) * 60 / (s.bpm * float64(p.BeatSize()))
+
+	swing := p.SwingPercent()
+	if s.swing > 0 {
+		swing = s.swing
+	}
+	if swing != drum.MinSwing {
+		beat := s.step % p.BeatSize()
+		switch {
+		case beat%2 == 0 && beat+1 < p.BeatSize() && s.step+1 < p.StepCount():
+			return 2 * frames * float64(swing) / 100
+		case beat%2 == 1:
+			return 2 * frames * float64(100-swing) / 100
+		}
+	}
+	return frames
+}
+
+// advance plays the current step and moves on to the next one.
+func (s *Sequencer) advance() {
+	p := s.patterns[s.pattern]
+
+	// Instruments hit on this step first choke the others in their group
+	for _, track := range p.Tracks {
+		if s.step < len(track.Steps) && track.Steps[s.step].Hit() {
+			s.choke(s.instruments[keyOf(track)])
+		}
+	}
+	for _, track := range p.Tracks {
+		if s.step < len(track.Steps) && track.Steps[s.step].Hit() {
+			s.instruments[keyOf(track)].Hit(track.Steps[s.step].Velocity)
+		}
+	}
+	s.notify(StepChanged)
+
+	s.step++
+	if s.step >= p.StepCount() {
+		s.step = 0
+		s.pattern++
+		s.pattern %= len(s.patterns)
+		if len(s.patterns) > 1 {
+			s.notify(PatternChanged)
+		}
+	}
+}
+
+// tracks returns the instruments of the tracks with the given ID.
+func (s *Sequencer) tracks(id int32) []*Instrument {
+	var instruments []*Instrument
+	for key, instrument := range s.instruments {
+		if key.ID == id {
+			instruments = append(instruments, instrument)
+		}
+	}
+	return instruments
+}
+
+// choke cuts off the instruments in the same choke group as hit.
+func (s *Sequencer) choke(hit *Instrument) {
+	if hit.choke == 0 {
+		return
+	}
+	for _, instrument := range s.instruments {
+		if instrument != hit && instrument.choke == hit.choke {
+			instrument.Choke()
+		}
+	}
+}
+
+type commandKind int
+
+const (
+	addCommand commandKind = iota
+	startCommand
+	stopCommand
+	resetCommand
+	seekCommand
+	tempoCommand
+	rampCommand
+	swingCommand
+	panCommand
+	gainCommand
+	polyphonyCommand
+	chokeCommand
+	masterGainCommand
+	clippingCommand
+	ditherCommand
+)
+
+type command struct {
+	kind        commandKind
+	pattern     *drum.Pattern
+	instruments map[trackKey]*Instrument
+	index, step int
+	id          int32
+	value       float64
+	stealing    Stealing
+	next        atomic.Pointer[command]
+}
+
+// queue is an unbounded queue of commands that any number of goroutines
+// can push to and one goroutine pops from, without locks. Pushing swaps
+// the command in as the new head; popping follows the links from the
+// tail, which is always a command that has already been popped.
+type queue struct {
+	head atomic.Pointer[command]
+	tail *command
+}
+
+func (q *queue) init() {
+	stub := &command{}
+	q.head.Store(stub)
+	q.tail = stub
+}
+
+func (q *queue) push(c *command) {
+	prev := q.head.Swap(c)
+	prev.next.Store(c)
+}
+
+// pop returns the oldest command in the queue, or nil if it is empty.
+func (q *queue) pop() *command {
+	next := q.tail.next.Load()
+	if next == nil {
+		return nil
+	}
+	q.tail = next
+	return next
+}
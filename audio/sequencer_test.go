@@ -0,0 +1,279 @@
+package audio
+
+import (
+	"context"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/kit"
+	"math"
+	"sync"
+	"testing"
+)
+
+// add queues a pattern with silent instruments, so that no samples are
+// needed to run the sequencer.
+func add(s *Sequencer, p *drum.Pattern) {
+	instruments := make(map[trackKey]*Instrument)
+	for _, track := range p.Tracks {
+		instruments[keyOf(track)] = NewInstrument(make(Sample, 64), DefaultRate)
+	}
+	s.commands.push(&command{kind: addCommand, pattern: p, instruments: instruments})
+}
+
+func testPattern(tempo float32, length int) *drum.Pattern {
+	steps := make([]drum.Step, length)
+	steps[0].Velocity = drum.MaxVelocity
+	return &drum.Pattern{
+		Tempo:  tempo,
+		Length: length,
+		Tracks: []*drum.Track{{ID: 1, Name: "kick", Steps: steps}},
+	}
+}
+
+func TestSequencerEvents(t *testing.T) {
+	s := NewSequencer(nil)
+	add(s, testPattern(120, 4))
+	add(s, testPattern(120, 4))
+	s.Start()
+
+	// At 120 BPM a step lasts 5512.5 frames, so eight steps fit in this
+	// buffer with some to spare.
+	s.Read(make([]int32, 45000*DefaultChannels))
+
+	var steps []Event
+	for len(s.events) > 0 {
+		if e := <-s.Events(); e.Kind == StepChanged {
+			steps = append(steps, e)
+		}
+	}
+	if len(steps) != 9 {
+		t.Fatalf("expected 9 steps, got %d", len(steps))
+	}
+	for i, e := range steps {
+		if e.Pattern != i/4%2 || e.Step != i%4 || !e.Running {
+			t.Errorf("step %d: got %+v", i, e)
+		}
+	}
+}
+
+func TestSequencerCommands(t *testing.T) {
+	s := NewSequencer(nil)
+	add(s, testPattern(120, 4))
+	add(s, testPattern(120, 4))
+	s.Seek(1, 2)
+	s.SetTempo(240)
+	s.Start()
+	s.Read(make([]int32, 2*DefaultChannels))
+
+	if !s.running || s.pattern != 1 || s.step != 3 {
+		t.Fatalf("expected to be running at pattern 1 step 3, got %v %d %d", s.running, s.pattern, s.step)
+	}
+	if frames := s.stepFrames(s.patterns[0]); frames != DefaultRate*60/(240.0*4) {
+		t.Errorf("expected the tempo to be overridden, got %v frames a step", frames)
+	}
+
+	s.Reset()
+	s.Read(make([]int32, 2*DefaultChannels))
+	if s.running || s.pattern != 0 || s.step != 0 {
+		t.Errorf("expected to be reset, got %v %d %d", s.running, s.pattern, s.step)
+	}
+}
+
+// TestSequencerConcurrentControl is meant for go test -race.
+func TestSequencerConcurrentControl(t *testing.T) {
+	s := NewSequencer(nil)
+	add(s, testPattern(120, 16))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]int32, 256*DefaultChannels)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				s.Read(buf)
+			}
+		}
+	}()
+
+	var control sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		control.Add(1)
+		go func(i int) {
+			defer control.Done()
+			for j := 0; j < 500; j++ {
+				switch j % 5 {
+				case 0:
+					s.Start()
+				case 1:
+					s.SetTempo(float64(60 + i*j%180))
+				case 2:
+					s.Seek(0, j%16)
+				case 3:
+					s.Stop()
+				case 4:
+					s.Reset()
+				}
+				select {
+				case <-s.Events():
+				default:
+				}
+			}
+		}(i)
+	}
+	control.Wait()
+	close(done)
+	wg.Wait()
+}
+
+func TestSequencerStereo(t *testing.T) {
+	s := NewSequencer(nil)
+	p := testPattern(120, 4)
+	p.Tracks = append(p.Tracks, &drum.Track{ID: 2, Name: "snare", Steps: p.Tracks[0].Steps})
+	s.commands.push(&command{kind: addCommand, pattern: p, instruments: map[trackKey]*Instrument{
+		{1, "kick"}:  NewInstrument(Sample{0.5, -0.5, 0.25, -0.25}, DefaultRate),
+		{2, "snare"}: NewInstrument(Sample{0.125, 0.125}, DefaultRate),
+	}})
+	s.SetPan(2, -0.5)
+	s.SetGain(2, 2)
+	s.SetMasterGain(1)
+	s.SetClipping(HardClip)
+	s.Start()
+
+	// Each sample frame is played once, into both channels
+	data := make([]int32, 3*DefaultChannels)
+	s.Read(data)
+	expected := []float64{0.75, -0.375, 0.25, -0.25, 0, 0}
+	for i := range expected {
+		if data[i] != int32(expected[i]*math.MaxInt32) {
+			t.Fatalf("expected %v, got %v", expected, data)
+		}
+	}
+}
+
+func TestSequencerConfig(t *testing.T) {
+	tData := []struct {
+		channels int
+		expected []float64
+	}{
+		{1, []float64{0.25, 0.125, 0}},
+		{4, []float64{0.5, 0, 0, 0, 0.25, 0, 0, 0}},
+	}
+
+	for _, exp := range tData {
+		s := NewSequencer(&Options{Config: Config{Rate: 96000, Channels: exp.channels}})
+		s.commands.push(&command{kind: addCommand, pattern: testPattern(120, 4), instruments: map[trackKey]*Instrument{
+			{1, "kick"}: NewInstrument(Sample{0.5, 0, 0.25, 0}, 96000),
+		}})
+		s.SetMasterGain(1)
+		s.Start()
+
+		data := make([]int32, len(exp.expected))
+		s.Read(data)
+		for i := range exp.expected {
+			if data[i] != int32(exp.expected[i]*math.MaxInt32) {
+				t.Fatalf("%d channels: expected %v, got %v", exp.channels, exp.expected, data)
+			}
+		}
+
+		// At 120 BPM a step lasts an eighth of a second
+		if frames := s.stepFrames(s.patterns[0]); frames != 12000 {
+			t.Errorf("%d channels: expected steps of 12000 frames, got %v", exp.channels, frames)
+		}
+	}
+}
+
+func TestSequencerTempoRamp(t *testing.T) {
+	tData := []struct {
+		ramp     int
+		frames   int
+		expected []float64
+	}{
+		{0, 35000, []float64{120, 120, 120, 120, 240, 240, 240, 240, 120}},
+		{4, 36100, []float64{120, 120, 120, 120, 150, 180, 210, 240, 210}},
+	}
+
+	for _, exp := range tData {
+		s := NewSequencer(&Options{Ramp: exp.ramp})
+		add(s, testPattern(120, 4))
+		add(s, testPattern(240, 4))
+		s.Start()
+		s.Read(make([]int32, exp.frames*DefaultChannels))
+
+		var tempos []float64
+		for len(s.events) > 0 {
+			if e := <-s.Events(); e.Kind == StepChanged {
+				tempos = append(tempos, e.Tempo)
+			}
+		}
+		if len(tempos) != len(exp.expected) {
+			t.Fatalf("ramp %d: expected tempos %v, got %v", exp.ramp, exp.expected, tempos)
+		}
+		for i := range tempos {
+			if math.Abs(tempos[i]-exp.expected[i]) > 1e-9 {
+				t.Errorf("ramp %d: expected tempos %v, got %v", exp.ramp, exp.expected, tempos)
+				break
+			}
+		}
+	}
+}
+
+func TestSequencerSwing(t *testing.T) {
+	s := NewSequencer(nil)
+	p := testPattern(120, 6)
+	p.StepsPerBeat = 3
+	p.Swing = 60
+	add(s, p)
+	s.runCommands()
+
+	// Steps are paired within beats of three, leaving the third straight
+	check := func(expected []float64) {
+		t.Helper()
+		for i, frames := range expected {
+			s.step = i
+			if got := s.nextStepFrames(); math.Abs(got-frames) > 1e-9 {
+				t.Errorf("step %d: expected %v frames, got %v", i, frames, got)
+			}
+		}
+	}
+	check([]float64{8820, 5880, 7350, 8820, 5880, 7350})
+
+	s.SetSwing(50)
+	s.runCommands()
+	check([]float64{7350, 7350, 7350, 7350, 7350, 7350})
+
+	s.SetSwing(90)
+	s.runCommands()
+	check([]float64{11025, 3675, 7350, 11025, 3675, 7350})
+
+	s = NewSequencer(&Options{Swing: 10})
+	add(s, p)
+	s.runCommands()
+	check([]float64{7350, 7350, 7350, 7350, 7350, 7350})
+
+	// Patterns made in code can have any swing, which is kept in range
+	p.Swing = 150
+	s = NewSequencer(nil)
+	add(s, p)
+	s.runCommands()
+	check([]float64{11025, 3675, 7350, 11025, 3675, 7350})
+}
+
+func TestSequencerBadTempo(t *testing.T) {
+	s := NewSequencer(&Options{Kit: &kit.Kit{}})
+	for _, tempo := range []float32{0, -120, float32(math.Inf(1)), float32(math.NaN())} {
+		if _, err := s.Add(testPattern(tempo, 4)); err == nil {
+			t.Errorf("expected a tempo of %v to be refused", tempo)
+		}
+	}
+
+	// Patterns that get past Add still can't play forever
+	add(s, testPattern(0, 4))
+	s.Start()
+	if err := s.Play(context.Background(), Null, 1); err == nil {
+		t.Error("expected playing a pattern with no length to fail")
+	}
+}
@@ -4,15 +4,19 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 )
 
 const (
 	spliceHeader = "SPLICE"
-	version      = "0.808-alpha"
+	versionSize  = 32 // bytes set aside for the version string
+
+	// The shape of every pattern in the original format
+	defaultLength       = 16
+	defaultStepsPerBeat = 4
 )
 
 // DecodeFile decodes the drum machine file found at the provided path
@@ -23,123 +27,343 @@ func DecodeFile(path string) (*Pattern, error) {
 	if err != nil {
 		return nil, err
 	}
-	buf := bufio.NewReader(file)
+	defer file.Close()
+
+	return Decode(file)
+}
+
+// DecodeMode selects how strictly a pattern is checked while decoding.
+type DecodeMode int
+
+const (
+	// DefaultMode reads tracks for as many bytes as the pattern's length
+	// field says there are, without checking that they make sense.
+	DefaultMode DecodeMode = iota
 
-	// Read the SPLICE header
-	header := make([]byte, 6)
-	buf.Read(header)
+	// StrictMode rejects any pattern whose tracks don't exactly fill its
+	// declared length, that has data after that length, that has step
+	// values above MaxVelocity, or that has tracks without names.
+	StrictMode
+
+	// LenientMode applies the same checks as StrictMode but, rather than
+	// failing, stops at the first implausible track and returns the tracks
+	// before it along with warnings describing what was wrong.
+	LenientMode
+)
+
+// DecodeOptions configures DecodeWithOptions.
+type DecodeOptions struct {
+	Mode DecodeMode
+}
+
+// Decode decodes a drum machine pattern read from r. It is the streaming
+// counterpart to DecodeFile and may be used with any source of pattern data.
+// Malformed data is reported with a *DecodeError.
+func Decode(r io.Reader) (*Pattern, error) {
+	p, _, err := DecodeWithOptions(r, DecodeOptions{})
+	return p, err
+}
+
+// DecodeWithOptions decodes a drum machine pattern read from r using the
+// provided options. In LenientMode the returned warnings are *DecodeErrors
+// describing the data that was skipped; other modes never return warnings.
+func DecodeWithOptions(r io.Reader, opts DecodeOptions) (*Pattern, []error, error) {
+	stream := bufio.NewReader(r)
+	d := &decoder{r: stream, mode: opts.Mode, track: -1, eof: ErrBadHeader}
+
+	// Read the SPLICE header, which data too short to hold isn't a pattern
+	header, err := d.read("header", len(spliceHeader))
+	if err != nil {
+		return nil, nil, err
+	}
 	if string(header) != spliceHeader {
-		return nil, errors.New("Invalid splice file")
+		return nil, nil, &DecodeError{Track: -1, Field: "header", Err: ErrBadHeader}
 	}
+	d.eof = ErrTruncatedHeader
 
 	// Next up is an integer containing the number of bytes left to read
-	var remaining int64
-	err = binary.Read(buf, binary.BigEndian, &remaining)
+	length, err := d.read("length", 8)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	d.remaining = int64(binary.BigEndian.Uint64(length))
+	if d.remaining < versionSize+4 {
+		return nil, nil, &DecodeError{Offset: int64(len(spliceHeader)), Track: -1, Field: "length", Err: ErrLengthMismatch}
 	}
 
 	// The 32 byte long version string
-	version := make([]byte, 32)
-	_, err = io.ReadFull(buf, version)
+	version, err := d.read("version", versionSize)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	version = bytes.Trim(version, "\x00")
-	remaining -= 32
 
 	// Tempo is a little endian 32 bit floating point
-	var tempo float32
-	err = binary.Read(buf, binary.LittleEndian, &tempo)
+	tempo, err := d.read("tempo", 4)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	remaining -= 4
 
-	var tracks []*Track
-	for remaining > 0 {
-		// Track id is a little endian 32 bit int
-		var id int32
-		err = binary.Read(buf, binary.LittleEndian, &id)
-		if err != nil {
-			return nil, err
+	p := &Pattern{
+		Version:      string(version),
+		Tempo:        math.Float32frombits(binary.LittleEndian.Uint32(tempo)),
+		Length:       defaultLength,
+		StepsPerBeat: defaultStepsPerBeat,
+	}
+
+	// The tracks are buffered so that the extension block following
+	// them, which says how to read them, can be read first.
+	var body bytes.Buffer
+	n, err := io.Copy(&body, io.LimitReader(stream, d.remaining))
+	if err != nil {
+		return nil, nil, d.error("tracks", err)
+	}
+
+	var warnings []error
+	complete := n == d.remaining
+	if complete {
+		x := &decoder{mode: d.mode, offset: d.offset + n, track: -1, eof: ErrBadExtension}
+		if err := x.readExtension(stream, p); err != nil {
+			if d.mode != LenientMode {
+				return nil, nil, err
+			}
+			warnings = append(warnings, err)
+			p.Length, p.StepsPerBeat = defaultLength, defaultStepsPerBeat
 		}
-		remaining -= 4
 
-		// A byte indicating the length of the instrument name
-		l, err := buf.ReadByte()
-		if err != nil {
-			return nil, err
+		// Anything else doesn't belong to the pattern
+		if d.mode != DefaultMode {
+			if _, err := stream.ReadByte(); err == nil {
+				err := x.error("trailing data", ErrTrailingData)
+				if d.mode == StrictMode {
+					return nil, nil, err
+				}
+				warnings = append(warnings, err)
+			}
 		}
-		remaining--
 
-		// The instrument name
-		name := make([]byte, l)
-		_, err = io.ReadFull(buf, name)
+		// Running out of tracks early now means the length was wrong
+		d.eof = ErrLengthMismatch
+	} else {
+		d.eof = ErrTruncatedTrack
+	}
+
+	d.r = &body
+	for d.remaining > 0 {
+		d.track = len(p.Tracks)
+		track, err := d.readTrack(p.Length)
 		if err != nil {
-			return nil, err
-		}
-		remaining -= int64(l)
-
-		// 16 steps, 1 byte each
-		steps := make([]bool, 16)
-		for i := 0; i < 16; i++ {
-			s, err := buf.ReadByte()
-			if err != nil {
-				return nil, err
+			if d.mode != LenientMode {
+				return nil, nil, err
 			}
-			steps[i] = s == 1
-			remaining--
+			warnings = append(warnings, err)
+			break
 		}
+		p.Tracks = append(p.Tracks, track)
+	}
 
-		track := &Track{
-			ID:    id,
-			Name:  string(name),
-			Steps: steps,
+	return p, warnings, nil
+}
+
+func (d *decoder) readTrack(length int) (*Track, error) {
+	// Track id is a little endian 32 bit int
+	id, err := d.read("id", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	// A byte indicating the length of the instrument name
+	l, err := d.read("name length", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// The instrument name
+	name, err := d.read("name", int(l[0]))
+	if err != nil {
+		return nil, err
+	}
+	if d.mode != DefaultMode && len(name) == 0 {
+		return nil, &DecodeError{Offset: d.offset - 1, Track: d.track, Field: "name length", Err: ErrEmptyName}
+	}
+
+	// The pattern's length in steps, 1 byte each
+	raw, err := d.read("steps", length)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]Step, len(raw))
+	for i, s := range raw {
+		if d.mode != DefaultMode && s > MaxVelocity {
+			return nil, &DecodeError{Offset: d.offset - int64(len(raw)-i), Track: d.track, Field: "steps", Err: ErrBadStep}
 		}
-		tracks = append(tracks, track)
+		steps[i] = decodeStep(s)
 	}
 
-	p := &Pattern{
-		Version: string(version),
-		Tempo:   tempo,
-		Tracks:  tracks,
+	track := &Track{
+		ID:    int32(binary.LittleEndian.Uint32(id)),
+		Name:  string(name),
+		Steps: steps,
+	}
+	return track, nil
+}
+
+// decoder reads the fields of a pattern, keeping track of where it is
+// so that failures can be reported precisely.
+type decoder struct {
+	r         io.Reader
+	mode      DecodeMode
+	offset    int64 // bytes consumed from r
+	remaining int64 // bytes left according to the length field
+	track     int   // index of the track being read, -1 outside the tracks
+	eof       error // reported when r runs out in the middle of a field
+}
+
+// read returns the next n bytes of input for the named field.
+func (d *decoder) read(field string, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = d.eof
+		}
+		return nil, d.error(field, err)
+	}
+	d.offset += int64(n)
+	d.remaining -= int64(n)
+	return buf, nil
+}
+
+// error wraps err in a *DecodeError for the field at the current offset.
+func (d *decoder) error(field string, err error) error {
+	return &DecodeError{
+		Offset: d.offset,
+		Track:  d.track,
+		Field:  field,
+		Err:    err,
 	}
-	return p, nil
 }
 
 // Pattern is the high level representation of the
 // drum pattern contained in a .splice file.
 type Pattern struct {
 	Version string
-	Tempo   float32
-	Tracks  []*Track
+	Tempo   float32 // beats per minute
+
+	// Length is the number of steps in each track and StepsPerBeat
+	// the number of those steps that make up one beat. When zero they
+	// default to the original format's 16 steps of 4 per beat.
+	Length       int
+	StepsPerBeat int
+
+	// Swing is the percentage of each pair of steps in a beat that the
+	// first of them lasts, from MinSwing, evenly spaced, to MaxSwing,
+	// which delays the second by half a step. When zero the steps are
+	// evenly spaced.
+	Swing int
+
+	Tracks []*Track
+}
+
+// The range of a pattern's Swing.
+const (
+	MinSwing = 50
+	MaxSwing = 75
+)
+
+// StepCount returns the number of steps in the pattern.
+func (p *Pattern) StepCount() int {
+	if p.Length > 0 {
+		return p.Length
+	}
+	return defaultLength
+}
+
+// BeatSize returns the number of steps in one beat of the pattern.
+func (p *Pattern) BeatSize() int {
+	if p.StepsPerBeat > 0 {
+		return p.StepsPerBeat
+	}
+	return defaultStepsPerBeat
+}
+
+// SwingPercent returns the pattern's swing, MinSwing if it isn't swung.
+// A Swing outside MinSwing to MaxSwing is brought to the nearest of them.
+func (p *Pattern) SwingPercent() int {
+	switch {
+	case p.Swing > MaxSwing:
+		return MaxSwing
+	case p.Swing > MinSwing:
+		return p.Swing
+	}
+	return MinSwing
 }
 
 func (p *Pattern) String() string {
 	s := "Saved with HW Version: " + p.Version + "\n"
 	s += fmt.Sprintf("Tempo: %v\n", p.Tempo)
+	if p.SwingPercent() != MinSwing {
+		s += fmt.Sprintf("Swing: %d%%\n", p.SwingPercent())
+	}
 	for _, track := range p.Tracks {
-		s += track.String()
+		s += track.format(p.BeatSize())
 	}
 
 	return s
 }
 
+// MaxVelocity is the velocity of the loudest possible hit.
+const MaxVelocity = 127
+
+// Step is a single step of a Track.
+type Step struct {
+	Velocity uint8 // 0 for no hit, up to MaxVelocity
+}
+
+// Hit reports whether the step plays its instrument.
+func (s Step) Hit() bool {
+	return s.Velocity > 0
+}
+
+// The original format only knew 0 and 1 for its steps, so a 1 is
+// taken to be a full velocity hit and anything from 2 to MaxVelocity
+// is a velocity.
+func decodeStep(b byte) Step {
+	if b == 1 || b > MaxVelocity {
+		return Step{Velocity: MaxVelocity}
+	}
+	return Step{Velocity: b}
+}
+
+func encodeStep(s Step) byte {
+	switch {
+	case s.Velocity >= MaxVelocity:
+		return 1
+	case s.Velocity == 1:
+		// There's no way to say 1, so make it the quietest hit there is
+		return 2
+	}
+	return s.Velocity
+}
+
 // Track is the instrument track within the Pattern.
 type Track struct {
 	ID    int32
 	Name  string
-	Steps []bool
+	Steps []Step
 }
 
 func (t *Track) String() string {
+	return t.format(defaultStepsPerBeat)
+}
+
+// format renders the track with its steps grouped into beats.
+func (t *Track) format(beat int) string {
 	s := fmt.Sprintf("(%d) %s\t", t.ID, t.Name)
 	for i, step := range t.Steps {
-		if i%4 == 0 {
+		if i%beat == 0 {
 			s += "|"
 		}
-		if step {
+		if step.Hit() {
 			s += "x"
 		} else {
 			s += "-"
@@ -1,9 +1,16 @@
 package drum
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestDecodeFile(t *testing.T) {
@@ -73,3 +80,167 @@ Tempo: 999
 		}
 	}
 }
+
+func TestDecode(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+
+	expected, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(decoded) != fmt.Sprint(expected) {
+		t.Fatalf("Decode and DecodeFile disagree.\nGot:\n%s\nExpected:\n%s", decoded, expected)
+	}
+}
+
+func TestDecodeInvalidHeader(t *testing.T) {
+	for _, data := range []string{"", "SPL", "NOTASPLICEFILE"} {
+		if _, err := Decode(strings.NewReader(data)); !errors.Is(err, ErrBadHeader) {
+			t.Errorf("expected ErrBadHeader decoding %q, got %v", data, err)
+		}
+	}
+
+	// Errors reading the header are passed on rather than taken for a bad one
+	failed := errors.New("connection reset")
+	_, err := Decode(iotest.ErrReader(failed))
+	if e, ok := err.(*DecodeError); !ok || e.Field != "header" || !errors.Is(err, failed) {
+		t.Errorf("expected the read error for the header, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	short := append([]byte{}, data...)
+	short[13] = 20
+
+	tData := []struct {
+		name   string
+		data   []byte
+		err    error
+		offset int64
+		track  int
+		field  string
+	}{
+		{"no length", data[:10], ErrTruncatedHeader, 6, -1, "length"},
+		{"short length", short, ErrLengthMismatch, 6, -1, "length"},
+		{"no tempo", data[:48], ErrTruncatedHeader, 46, -1, "tempo"},
+		{"mid name", data[:57], ErrTruncatedTrack, 55, 0, "name"},
+		{"mid steps", data[:100], ErrTruncatedTrack, 85, 1, "steps"},
+	}
+
+	for _, exp := range tData {
+		_, err := Decode(bytes.NewReader(exp.data))
+		if !errors.Is(err, exp.err) {
+			t.Fatalf("%s: expected %v, got %v", exp.name, exp.err, err)
+		}
+
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Fatalf("%s: expected a *DecodeError, got %T", exp.name, err)
+		}
+		if de.Offset != exp.offset || de.Track != exp.track || de.Field != exp.field {
+			t.Errorf("%s: got offset %d track %d field %q, expected offset %d track %d field %q",
+				exp.name, de.Offset, de.Track, de.Field, exp.offset, exp.track, exp.field)
+		}
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	for _, name := range fixtures[:4] {
+		file, err := os.Open(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, warnings, err := DecodeWithOptions(file, DecodeOptions{Mode: StrictMode})
+		file.Close()
+		if err != nil || warnings != nil {
+			t.Fatalf("%s: expected a clean strict decode, got %v %v", name, err, warnings)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_5.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = DecodeWithOptions(bytes.NewReader(data), DecodeOptions{Mode: StrictMode})
+	if !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("expected ErrTrailingData, got %v", err)
+	}
+
+	data, err = ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[85] = 200 // first step of the snare
+	_, _, err = DecodeWithOptions(bytes.NewReader(data), DecodeOptions{Mode: StrictMode})
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrBadStep) || de.Track != 1 || de.Offset != 85 {
+		t.Fatalf("expected ErrBadStep in track 1 at offset 85, got %v", err)
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Claim some garbage as part of the pattern
+	garbage := []byte("\x07\x00\x00\x00\x00SPLICE")
+	data = append(data, garbage...)
+	binary.BigEndian.PutUint64(data[6:14], binary.BigEndian.Uint64(data[6:14])+uint64(len(garbage)))
+
+	p, warnings, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{Mode: LenientMode})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(p.Tracks) != 6 {
+		t.Errorf("expected 6 recovered tracks, got %d", len(p.Tracks))
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrEmptyName) {
+		t.Errorf("expected an ErrEmptyName warning, got %v", warnings)
+	}
+
+	if _, _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{Mode: StrictMode}); !errors.Is(err, ErrEmptyName) {
+		t.Errorf("expected strict mode to fail with ErrEmptyName, got %v", err)
+	}
+}
+
+func TestDecodeBadExtension(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, "SPLX\x00\x00\x00\x01\x02"...)
+
+	_, err = Decode(bytes.NewReader(data))
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrBadExtension) || de.Offset != 219 {
+		t.Fatalf("expected ErrBadExtension at offset 219, got %v", err)
+	}
+}
+
+func TestDecodeBadSwing(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, "SPLX\x00\x00\x00\x0a\x01SWNG\x00\x00\x00\x01\x5a"...)
+
+	if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrBadExtension) {
+		t.Fatalf("expected ErrBadExtension for a swing of 90%%, got %v", err)
+	}
+}
@@ -3,17 +3,66 @@ package drum
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
-	"log"
+	"math"
 	"os"
-	"unsafe"
 )
 
+// VersionError is returned when a pattern's Version is too long to
+// be stored in a pattern file.
+type VersionError struct {
+	Version string
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("drum: version %q is longer than %d bytes", e.Version, versionSize)
+}
+
+// NameError is returned when a track's Name is too long to be stored
+// in a pattern file.
+type NameError struct {
+	Track int // index of the offending track
+	Name  string
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("drum: track %d name %q is longer than %d bytes", e.Track, e.Name, math.MaxUint8)
+}
+
+// StepsError is returned when a pattern's steps can't be encoded, either
+// because a track doesn't have as many steps as the pattern or because
+// the pattern's shape is out of range.
+type StepsError struct {
+	Track  int // index of the offending track, or -1 for the pattern itself
+	Steps  int // steps in the track, or steps per beat for the pattern
+	Length int // steps in the pattern
+}
+
+func (e *StepsError) Error() string {
+	if e.Track < 0 {
+		return fmt.Sprintf("drum: pattern of %d steps with %d per beat can't be encoded", e.Length, e.Steps)
+	}
+	return fmt.Sprintf("drum: track %d has %d steps, pattern has %d", e.Track, e.Steps, e.Length)
+}
+
+// SwingError is returned when a pattern's Swing is outside MinSwing to
+// MaxSwing.
+type SwingError struct {
+	Swing int
+}
+
+func (e *SwingError) Error() string {
+	return fmt.Sprintf("drum: swing of %d%% is outside %d%% to %d%%", e.Swing, MinSwing, MaxSwing)
+}
+
+// spliceWriter buffers the body of a pattern so that the length
+// prefix can be written ahead of it. The first error encountered
+// is kept and reported by flush.
 type spliceWriter struct {
-	w     io.Writer
-	err   error
-	count uint64
-	b     bytes.Buffer
+	w   io.Writer
+	err error
+	b   bytes.Buffer
 }
 
 func (p *spliceWriter) write(buf []byte) {
@@ -21,14 +70,7 @@ func (p *spliceWriter) write(buf []byte) {
 		return
 	}
 
-	n, err := p.b.Write(buf)
-	if err != nil {
-		p.err = err
-		return
-	}
-
-	log.Printf("Increasing count by %d", n)
-	p.count += uint64(n)
+	_, p.err = p.b.Write(buf)
 }
 
 func (p *spliceWriter) bwrite(order binary.ByteOrder, data interface{}) {
@@ -36,17 +78,7 @@ func (p *spliceWriter) bwrite(order binary.ByteOrder, data interface{}) {
 		return
 	}
 
-	// Should really use reflect and get the size?
-	err := binary.Write(&p.b, order, data)
-	if err != nil {
-		p.err = err
-		return
-	}
-
-	c := unsafe.Sizeof(data)
-
-	log.Printf("(b) Increasing count by %d", c)
-	p.count += uint64(c)
+	p.err = binary.Write(&p.b, order, data)
 }
 
 func (p *spliceWriter) flush() error {
@@ -54,21 +86,17 @@ func (p *spliceWriter) flush() error {
 		return p.err
 	}
 
-	// should handle short writes
 	if _, err := p.w.Write([]byte(spliceHeader)); err != nil {
 		return err
 	}
 
-	log.Printf("Writing a count of %d\n", p.count)
-	if err := binary.Write(p.w, binary.BigEndian, p.count); err != nil {
+	// The length counts every byte following it
+	if err := binary.Write(p.w, binary.BigEndian, int64(p.b.Len())); err != nil {
 		return err
 	}
 
-	if _, err := io.Copy(p.w, &p.b); err != nil {
-		return err
-	}
-
-	return p.err
+	_, err := io.Copy(p.w, &p.b)
+	return err
 }
 
 // Encode encodes the pattern to the file found at the provided path.
@@ -77,13 +105,46 @@ func Encode(pat *Pattern, path string) error {
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	buf := &spliceWriter{w: file}
+	if err := EncodeTo(file, pat); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// EncodeTo writes the pattern to w in the format read by Decode.
+// The pattern's Version is written as is; a *VersionError is returned
+// if it does not fit, and a *NameError if a track's Name does not.
+// Patterns that aren't 16 steps of 4 per beat are written with an
+// extension block, as are swung patterns, which only this package's
+// decoder understands.
+func EncodeTo(w io.Writer, pat *Pattern) error {
+	if len(pat.Version) > versionSize {
+		return &VersionError{Version: pat.Version}
+	}
+
+	length := pat.StepCount()
+	if length > math.MaxUint16 || pat.BeatSize() > math.MaxUint8 {
+		return &StepsError{Track: -1, Steps: pat.BeatSize(), Length: length}
+	}
+	if pat.Swing != 0 && (pat.Swing < MinSwing || pat.Swing > MaxSwing) {
+		return &SwingError{Swing: pat.Swing}
+	}
+	for i, track := range pat.Tracks {
+		if len(track.Steps) != length {
+			return &StepsError{Track: i, Steps: len(track.Steps), Length: length}
+		}
+		if len(track.Name) > math.MaxUint8 {
+			return &NameError{Track: i, Name: track.Name}
+		}
+	}
+
+	buf := &spliceWriter{w: w}
 
 	// Write version string with null padding
-	buf.write([]byte(version))
-	buf.write(bytes.Repeat([]byte{0}, 32-len(version)))
+	buf.write([]byte(pat.Version))
+	buf.write(bytes.Repeat([]byte{0}, versionSize-len(pat.Version)))
 
 	// Write tempo
 	buf.bwrite(binary.LittleEndian, pat.Tempo)
@@ -91,16 +152,15 @@ func Encode(pat *Pattern, path string) error {
 	// Write tracks
 	for _, track := range pat.Tracks {
 		buf.bwrite(binary.LittleEndian, track.ID)
-		buf.bwrite(binary.BigEndian, uint8(len(track.Name)))
+		buf.bwrite(binary.LittleEndian, uint8(len(track.Name)))
 		buf.write([]byte(track.Name))
 		for _, step := range track.Steps {
-			if step {
-				buf.bwrite(binary.BigEndian, []byte{1})
-			} else {
-				buf.bwrite(binary.BigEndian, []byte{0})
-			}
+			buf.write([]byte{encodeStep(step)})
 		}
 	}
 
-	return buf.flush()
+	if err := buf.flush(); err != nil {
+		return err
+	}
+	return writeExtension(w, pat)
 }
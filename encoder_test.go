@@ -0,0 +1,225 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+var fixtures = []string{
+	"pattern_1.splice",
+	"pattern_2.splice",
+	"pattern_3.splice",
+	"pattern_4.splice",
+	"pattern_5.splice",
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, name := range fixtures {
+		pattern, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := EncodeTo(&buf, pattern); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", name, err)
+		}
+
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("something went wrong decoding encoded %s - %v", name, err)
+		}
+
+		if fmt.Sprint(decoded) != fmt.Sprint(pattern) {
+			t.Fatalf("%s didn't round trip.\nGot:\n%s\nExpected:\n%s", name, decoded, pattern)
+		}
+	}
+}
+
+func TestEncodeMatchesFixtures(t *testing.T) {
+	for _, name := range fixtures {
+		data, err := ioutil.ReadFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Anything past the declared length isn't part of the pattern
+		data = data[:14+binary.BigEndian.Uint64(data[6:14])]
+
+		pattern, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := EncodeTo(&buf, pattern); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", name, err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("%s wasn't encoded as expected.\nGot:\n%x\nExpected:\n%x", name, buf.Bytes(), data)
+		}
+	}
+}
+
+func TestEncodeVersionTooLong(t *testing.T) {
+	pattern := &Pattern{Version: strings.Repeat("9", 33), Tempo: 120}
+
+	err := EncodeTo(ioutil.Discard, pattern)
+	if _, ok := err.(*VersionError); !ok {
+		t.Fatalf("expected a *VersionError, got %v", err)
+	}
+}
+
+func TestEncodeStepCounts(t *testing.T) {
+	tData := []struct {
+		length int
+		beat   int
+		output string
+	}{
+		{12, 3, "(1) Kick\t|x--|x--|x--|x--|\n"},
+		{7, 2, "(1) Kick\t|x-|x-|x-|x|\n"},
+		{32, 4, "(1) Kick\t|x---|x---|x---|x---|x---|x---|x---|x---|\n"},
+	}
+
+	for _, exp := range tData {
+		steps := make([]Step, exp.length)
+		for i := range steps {
+			if i%exp.beat == 0 {
+				steps[i].Velocity = MaxVelocity
+			}
+		}
+		pattern := &Pattern{
+			Version:      "0.808-alpha",
+			Tempo:        120,
+			Length:       exp.length,
+			StepsPerBeat: exp.beat,
+			Tracks:       []*Track{{ID: 1, Name: "Kick", Steps: steps}},
+		}
+
+		var buf bytes.Buffer
+		if err := EncodeTo(&buf, pattern); err != nil {
+			t.Fatalf("%d steps: something went wrong encoding - %v", exp.length, err)
+		}
+
+		decoded, warnings, err := DecodeWithOptions(&buf, DecodeOptions{Mode: StrictMode})
+		if err != nil || warnings != nil {
+			t.Fatalf("%d steps: something went wrong decoding - %v %v", exp.length, err, warnings)
+		}
+		if decoded.Length != exp.length || decoded.StepsPerBeat != exp.beat {
+			t.Errorf("%d steps: decoded as %d steps of %d per beat", exp.length, decoded.Length, decoded.StepsPerBeat)
+		}
+
+		expected := "Saved with HW Version: 0.808-alpha\nTempo: 120\n" + exp.output
+		if fmt.Sprint(decoded) != expected {
+			t.Errorf("%d steps: got\n%s\nexpected\n%s", exp.length, decoded, expected)
+		}
+	}
+}
+
+func TestEncodeStepMismatch(t *testing.T) {
+	pattern := &Pattern{
+		Version: "0.808-alpha",
+		Tempo:   120,
+		Length:  12,
+		Tracks:  []*Track{{ID: 1, Name: "Kick", Steps: make([]Step, 16)}},
+	}
+
+	err := EncodeTo(ioutil.Discard, pattern)
+	if e, ok := err.(*StepsError); !ok || e.Track != 0 || e.Steps != 16 || e.Length != 12 {
+		t.Fatalf("expected a *StepsError for track 0, got %v", err)
+	}
+}
+
+func TestEncodeVelocity(t *testing.T) {
+	steps := make([]Step, 16)
+	for i, v := range []uint8{127, 0, 1, 64, 100, 2} {
+		steps[i].Velocity = v
+	}
+	pattern := &Pattern{
+		Version: "0.808-alpha",
+		Tempo:   120,
+		Tracks:  []*Track{{ID: 1, Name: "Kick", Steps: steps}},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeTo(&buf, pattern); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	raw := buf.Bytes()[buf.Len()-16:]
+	if !bytes.Equal(raw[:6], []byte{1, 0, 2, 64, 100, 2}) {
+		t.Errorf("steps were encoded as %v", raw)
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("something went wrong decoding - %v", err)
+	}
+	for i, v := range []uint8{127, 0, 2, 64, 100, 2} {
+		if got := decoded.Tracks[0].Steps[i].Velocity; got != v {
+			t.Errorf("step %d: expected velocity %d, got %d", i, v, got)
+		}
+	}
+}
+
+func TestEncodeSwing(t *testing.T) {
+	steps := make([]Step, 16)
+	steps[0].Velocity = MaxVelocity
+	pattern := &Pattern{
+		Version: "0.808-alpha",
+		Tempo:   98,
+		Swing:   62,
+		Tracks:  []*Track{{ID: 1, Name: "Kick", Steps: steps}},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeTo(&buf, pattern); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	decoded, warnings, err := DecodeWithOptions(&buf, DecodeOptions{Mode: StrictMode})
+	if err != nil || warnings != nil {
+		t.Fatalf("something went wrong decoding - %v %v", err, warnings)
+	}
+	if decoded.Swing != 62 || decoded.StepCount() != 16 {
+		t.Errorf("expected 16 steps swung 62%%, got %d steps swung %d%%", decoded.StepCount(), decoded.Swing)
+	}
+	if !strings.Contains(decoded.String(), "Swing: 62%\n") {
+		t.Errorf("expected the swing to be shown, got\n%s", decoded)
+	}
+
+	pattern.Swing = 80
+	if err := EncodeTo(&buf, pattern); err == nil {
+		t.Error("expected an error for a swing of 80%")
+	} else if _, ok := err.(*SwingError); !ok {
+		t.Errorf("expected a *SwingError, got %v", err)
+	}
+}
+
+func TestEncodeLongName(t *testing.T) {
+	pattern := &Pattern{
+		Version: "0.808-alpha",
+		Tempo:   120,
+		Tracks: []*Track{
+			{ID: 1, Name: "Kick", Steps: make([]Step, 16)},
+			{ID: 2, Name: strings.Repeat("x", 256), Steps: make([]Step, 16)},
+		},
+	}
+
+	err := EncodeTo(ioutil.Discard, pattern)
+	if e, ok := err.(*NameError); !ok || e.Track != 1 {
+		t.Fatalf("expected a *NameError for track 1, got %v", err)
+	}
+
+	pattern.Tracks[1].Name = strings.Repeat("x", 255)
+	var buf bytes.Buffer
+	if err := EncodeTo(&buf, pattern); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if decoded, err := Decode(&buf); err != nil || decoded.Tracks[1].Name != pattern.Tracks[1].Name {
+		t.Errorf("expected a 255 byte name to round trip, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package drum
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors reported by Decode. They are wrapped in a *DecodeError which
+// records where in the data the problem was found, so callers should
+// test for them with errors.Is.
+var (
+	ErrBadHeader       = errors.New("not a splice file")
+	ErrTruncatedHeader = errors.New("data ends inside the pattern header")
+	ErrTruncatedTrack  = errors.New("data ends inside a track")
+	ErrLengthMismatch  = errors.New("pattern length does not match its contents")
+	ErrTrailingData    = errors.New("data follows the end of the pattern")
+	ErrBadStep         = errors.New("step value is not a velocity")
+	ErrEmptyName       = errors.New("track has no name")
+	ErrBadExtension    = errors.New("malformed extension block")
+)
+
+// DecodeError describes a failure to decode a pattern.
+type DecodeError struct {
+	Offset int64  // byte offset of the field being decoded
+	Track  int    // index of the track being decoded, or -1 for the header
+	Field  string // name of the field being decoded
+	Err    error  // the underlying error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Track < 0 {
+		return fmt.Sprintf("drum: %s: %s at offset %d", e.Field, e.Err, e.Offset)
+	}
+	return fmt.Sprintf("drum: track %d %s: %s at offset %d", e.Track, e.Field, e.Err, e.Offset)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,138 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Patterns that can't be described by the original format carry an
+// extension block after the bytes counted by their length field, where
+// decoders that predate it never look:
+//
+//	"SPLX"  magic
+//	uint32  big endian count of the bytes that follow
+//	uint8   extension version, currently 1
+//	chunks  each a 4 byte tag, a big endian uint32 size and its data
+//
+// Chunks with tags that aren't known are skipped. The known chunks are:
+//
+//	"STEP"  uint16 big endian steps per track, uint8 steps per beat
+//	"SWNG"  uint8 swing percentage, from 50 to 75
+const (
+	extensionMagic   = "SPLX"
+	extensionVersion = 1
+
+	stepChunk  = "STEP"
+	swingChunk = "SWNG"
+)
+
+// readExtension reads the extension block from stream into p if there
+// is one.
+func (d *decoder) readExtension(stream *bufio.Reader, p *Pattern) error {
+	magic, err := stream.Peek(len(extensionMagic))
+	if err != nil || string(magic) != extensionMagic {
+		return nil
+	}
+
+	d.r = stream
+	if _, err := d.read("extension", len(extensionMagic)); err != nil {
+		return err
+	}
+	size, err := d.read("extension size", 4)
+	if err != nil {
+		return err
+	}
+	var block bytes.Buffer
+	if _, err := io.CopyN(&block, stream, int64(binary.BigEndian.Uint32(size))); err != nil {
+		if err == io.EOF {
+			err = ErrBadExtension
+		}
+		return d.error("extension", err)
+	}
+
+	chunks := bytes.NewReader(block.Bytes())
+	d.r = chunks
+
+	version, err := d.read("extension version", 1)
+	if err != nil {
+		return err
+	}
+	if version[0] != extensionVersion {
+		return &DecodeError{Offset: d.offset - 1, Track: -1, Field: "extension version", Err: ErrBadExtension}
+	}
+
+	for chunks.Len() > 0 {
+		tag, err := d.read("chunk tag", 4)
+		if err != nil {
+			return err
+		}
+		size, err := d.read("chunk size", 4)
+		if err != nil {
+			return err
+		}
+		n := binary.BigEndian.Uint32(size)
+		if int64(n) > int64(chunks.Len()) {
+			return d.error(string(tag), ErrBadExtension)
+		}
+		bad := d.error(string(tag), ErrBadExtension)
+		data, err := d.read(string(tag), int(n))
+		if err != nil {
+			return err
+		}
+
+		switch string(tag) {
+		case stepChunk:
+			if len(data) < 3 {
+				return bad
+			}
+			p.Length = int(binary.BigEndian.Uint16(data))
+			p.StepsPerBeat = int(data[2])
+			if p.Length == 0 || p.StepsPerBeat == 0 {
+				return bad
+			}
+		case swingChunk:
+			if len(data) < 1 || data[0] < MinSwing || data[0] > MaxSwing {
+				return bad
+			}
+			p.Swing = int(data[0])
+		}
+	}
+	return nil
+}
+
+// writeExtension writes the extension block for p to w, if p needs one.
+func writeExtension(w io.Writer, p *Pattern) error {
+	var chunks bytes.Buffer
+
+	if p.StepCount() != defaultLength || p.BeatSize() != defaultStepsPerBeat {
+		data := make([]byte, 3)
+		binary.BigEndian.PutUint16(data, uint16(p.StepCount()))
+		data[2] = uint8(p.BeatSize())
+		writeChunk(&chunks, stepChunk, data)
+	}
+
+	if p.SwingPercent() != MinSwing {
+		writeChunk(&chunks, swingChunk, []byte{uint8(p.SwingPercent())})
+	}
+
+	if chunks.Len() == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(extensionMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(1+chunks.Len()))
+	buf.WriteByte(extensionVersion)
+	buf.Write(chunks.Bytes())
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeChunk(buf *bytes.Buffer, tag string, data []byte) {
+	buf.WriteString(tag)
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+}
@@ -0,0 +1,183 @@
+// Package kit reads sound kits, which choose the sound played for each
+// track of a pattern.
+//
+// A kit is a JSON file such as:
+//
+//	{
+//		"dir": "sounds",
+//		"fallback": "{name}.wav",
+//		"instruments": [
+//			{"names": ["kick", "SubKick"], "sample": "kick.wav", "gain": -3},
+//			{"names": ["hh-open", "ohat"], "sample": "ohat.wav", "pan": 0.3, "choke": 1},
+//			{"ids": [99], "sample": "conga.wav", "tune": -2, "voices": 2, "steal": "quietest"},
+//			{"names": ["cowbell"], "synth": {"voice": "cowbell", "decay": 0.3}}
+//		]
+//	}
+//
+// Sample paths are relative to dir, which is relative to the kit file.
+// Instruments with synth settings play a drum synthesized by the synth
+// package rather than a sample.
+package kit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/synth"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Kit maps the tracks of patterns to instruments.
+type Kit struct {
+	// Dir is the directory sample paths are relative to.
+	Dir string `json:"dir"`
+
+	// Fallback is the sample path of tracks that aren't in the kit, with
+	// "{name}" and "{id}" replaced by the track's name and ID. Tracks
+	// that aren't in the kit have no instrument if it's empty. Hi-hats
+	// played by the fallback are put in choke group 1, so that closing
+	// the hat cuts off an open hat.
+	Fallback string `json:"fallback"`
+
+	Instruments []Instrument `json:"instruments"`
+}
+
+// Instrument describes how a track is played.
+type Instrument struct {
+	// IDs and Names are the tracks the instrument plays. A track is
+	// played by the first instrument listing its ID or, failing that,
+	// the first listing its name. Names are matched ignoring case,
+	// spaces and punctuation, so "hh-open" matches "HH Open".
+	IDs   []int32  `json:"ids,omitempty"`
+	Names []string `json:"names,omitempty"`
+
+	// Sample is the path of the WAVE file played, unless Synth is set.
+	Sample string `json:"sample,omitempty"`
+
+	// Synth synthesizes the instrument instead of playing a sample.
+	Synth *synth.Params `json:"synth,omitempty"`
+
+	Gain  float64 `json:"gain,omitempty"`  // in dB
+	Pan   float64 `json:"pan,omitempty"`   // from -1, hard left, to 1, hard right
+	Tune  float64 `json:"tune,omitempty"`  // in semitones
+	Choke int     `json:"choke,omitempty"` // choke group, 0 for none
+
+	// Voices is the number of hits that can play at once, 0 for the
+	// player's default.
+	Voices int `json:"voices,omitempty"`
+
+	// Steal chooses the hit cut short when all the voices are playing,
+	// "oldest" or "quietest", or "" for the player's default.
+	Steal string `json:"steal,omitempty"`
+}
+
+// Default returns the kit of samples named after tracks, "kick.wav" for
+// a track named "kick", found in dir.
+func Default(dir string) *Kit {
+	return &Kit{Dir: dir, Fallback: "{name}.wav"}
+}
+
+// Load reads the kit file found at the provided path.
+func Load(path string) (*Kit, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	k, err := Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if !filepath.IsAbs(k.Dir) {
+		k.Dir = filepath.Join(filepath.Dir(path), k.Dir)
+	}
+	return k, nil
+}
+
+// Decode reads a kit from r. Its Dir is left as written.
+func Decode(r io.Reader) (*Kit, error) {
+	var k Kit
+	if err := json.NewDecoder(r).Decode(&k); err != nil {
+		return nil, err
+	}
+	for i, inst := range k.Instruments {
+		if inst.Sample == "" && inst.Synth == nil {
+			return nil, fmt.Errorf("kit: instrument %d has no sample or synth", i)
+		}
+		if inst.Synth != nil && !knownVoice(inst.Synth.Voice) {
+			return nil, fmt.Errorf("kit: instrument %d has unknown synth voice %q", i, inst.Synth.Voice)
+		}
+		if len(inst.IDs) == 0 && len(inst.Names) == 0 {
+			return nil, fmt.Errorf("kit: instrument %d has no ids or names", i)
+		}
+		if inst.Pan < -1 || inst.Pan > 1 {
+			return nil, fmt.Errorf("kit: instrument %d has a pan outside -1 to 1", i)
+		}
+		if inst.Steal != "" && inst.Steal != "oldest" && inst.Steal != "quietest" {
+			return nil, fmt.Errorf("kit: instrument %d steals voices by %q, not oldest or quietest", i, inst.Steal)
+		}
+	}
+	return &k, nil
+}
+
+// ErrNoInstrument is returned by Lookup for tracks the kit has no
+// instrument for.
+var ErrNoInstrument = errors.New("kit: no instrument for track")
+
+// Lookup returns the instrument that plays a track, with its Sample
+// joined to the kit's Dir unless it is absolute.
+func (k *Kit) Lookup(t *drum.Track) (Instrument, error) {
+	inst, ok := k.find(t)
+	if !ok {
+		if k.Fallback == "" {
+			return Instrument{}, ErrNoInstrument
+		}
+		sample := strings.NewReplacer("{name}", t.Name, "{id}", fmt.Sprint(t.ID)).Replace(k.Fallback)
+		inst = Instrument{Sample: sample}
+		if Classify(t.Name).Hat() {
+			inst.Choke = hatChoke
+		}
+	}
+
+	if inst.Sample != "" && !filepath.IsAbs(inst.Sample) {
+		inst.Sample = filepath.Join(k.Dir, inst.Sample)
+	}
+	return inst, nil
+}
+
+func (k *Kit) find(t *drum.Track) (Instrument, bool) {
+	for _, inst := range k.Instruments {
+		for _, id := range inst.IDs {
+			if id == t.ID {
+				return inst, true
+			}
+		}
+	}
+
+	name := Normalize(t.Name)
+	for _, inst := range k.Instruments {
+		for _, n := range inst.Names {
+			if Normalize(n) == name {
+				return inst, true
+			}
+		}
+	}
+	return Instrument{}, false
+}
+
+func knownVoice(voice string) bool {
+	for _, v := range synth.Voices {
+		if v == voice {
+			return true
+		}
+	}
+	return false
+}
+
+// hatChoke is the choke group of hi-hats played by the fallback.
+const hatChoke = 1
@@ -0,0 +1,126 @@
+package kit
+
+import (
+	"github.com/rubyist/drum"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKit = `{
+	"dir": "sounds",
+	"fallback": "{id}-{name}.wav",
+	"instruments": [
+		{"names": ["kick", "SubKick"], "sample": "kick.wav", "gain": -3},
+		{"names": ["hh-open"], "sample": "ohat.wav", "pan": 0.3, "choke": 1},
+		{"ids": [1], "sample": "one.wav", "tune": -2, "voices": 2},
+		{"names": ["cowbell"], "synth": {"voice": "cowbell", "decay": 0.2}}
+	]
+}`
+
+func TestLookup(t *testing.T) {
+	k, err := Decode(strings.NewReader(testKit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tData := []struct {
+		track  drum.Track
+		sample string
+		gain   float64
+	}{
+		{drum.Track{ID: 0, Name: "SubKick"}, "kick.wav", -3},
+		{drum.Track{ID: 5, Name: "HH Open"}, "ohat.wav", 0},
+		{drum.Track{ID: 1, Name: "kick"}, "one.wav", 0},
+		{drum.Track{ID: 7, Name: "Low Conga"}, "7-Low Conga.wav", 0},
+	}
+
+	for _, exp := range tData {
+		inst, err := k.Lookup(&exp.track)
+		if err != nil {
+			t.Fatalf("%s: %v", exp.track.Name, err)
+		}
+		if inst.Sample != filepath.Join("sounds", exp.sample) || inst.Gain != exp.gain {
+			t.Errorf("%s: expected %s at %vdB, got %s at %vdB", exp.track.Name, exp.sample, exp.gain, inst.Sample, inst.Gain)
+		}
+	}
+
+	inst, err := k.Lookup(&drum.Track{ID: 6, Name: "cowbell"})
+	if err != nil || inst.Sample != "" || inst.Synth == nil || inst.Synth.Decay != 0.2 || inst.Synth.Tone != 0.5 {
+		t.Errorf("expected a synthesized cowbell, got %+v %v", inst, err)
+	}
+
+	if inst, _ := k.Lookup(&drum.Track{ID: 8, Name: "hh-close"}); inst.Choke != hatChoke {
+		t.Errorf("expected hi-hats played by the fallback to be choked, got group %d", inst.Choke)
+	}
+
+	k.Fallback = ""
+	if _, err := k.Lookup(&drum.Track{ID: 7, Name: "Low Conga"}); err != ErrNoInstrument {
+		t.Errorf("expected ErrNoInstrument without a fallback, got %v", err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tData := []string{
+		`{"instruments": [{"names": ["kick"]}]}`,
+		`{"instruments": [{"sample": "kick.wav"}]}`,
+		`{"instruments": [{"names": ["kick"], "sample": "kick.wav", "pan": 2}]}`,
+		`{"instruments": {}}`,
+		`{"instruments": [{"names": ["gong"], "synth": {"voice": "gong"}}]}`,
+		`{"instruments": [{"names": ["kick"], "sample": "kick.wav", "steal": "loudest"}]}`,
+	}
+
+	for _, kit := range tData {
+		if _, err := Decode(strings.NewReader(kit)); err == nil {
+			t.Errorf("expected an error for %s", kit)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "808.json")
+	if err := ioutil.WriteFile(path, []byte(testKit), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Dir != filepath.Join(dir, "sounds") {
+		t.Errorf("expected samples relative to the kit, got %s", k.Dir)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tData := []struct {
+		name string
+		kind Kind
+	}{
+		{"SubKick", Kick},
+		{"hh-open", OpenHat},
+		{"HH Close", ClosedHat},
+		{"Closed Hi-Hat", ClosedHat},
+		{"Low Conga", LowConga},
+		{"hi conga", Conga},
+		{"Floor Tom", LowTom},
+		{"hi-tom", HiTom},
+		{"ride bell", Cowbell},
+		{"Maracas", Shaker},
+		{"laser", Unknown},
+	}
+
+	for _, exp := range tData {
+		if kind := Classify(exp.name); kind != exp.kind {
+			t.Errorf("%s: expected %q, got %q", exp.name, exp.kind, kind)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package kit
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Kind is the kind of drum a track plays, as judged by its name.
+type Kind string
+
+// The kinds of drum that Classify knows.
+const (
+	Unknown   Kind = ""
+	Kick      Kind = "kick"
+	Snare     Kind = "snare"
+	Clap      Kind = "clap"
+	Rim       Kind = "rim"
+	LowTom    Kind = "low-tom"
+	MidTom    Kind = "mid-tom"
+	HiTom     Kind = "hi-tom"
+	LowConga  Kind = "low-conga"
+	Conga     Kind = "conga"
+	Bongo     Kind = "bongo"
+	ClosedHat Kind = "closed-hat"
+	OpenHat   Kind = "open-hat"
+	Crash     Kind = "crash"
+	Ride      Kind = "ride"
+	Cowbell   Kind = "cowbell"
+	Shaker    Kind = "shaker"
+)
+
+// kindKeywords are the words looked for in normalized track names, in
+// order, so that "lowconga" is a low conga rather than a conga and
+// "hhopen" is an open hi-hat rather than a closed one.
+var kindKeywords = []struct {
+	words []string
+	kind  Kind
+}{
+	{[]string{"lowconga"}, LowConga},
+	{[]string{"conga"}, Conga},
+	{[]string{"bongo"}, Bongo},
+	{[]string{"lowtom", "floor"}, LowTom},
+	{[]string{"hitom", "hightom"}, HiTom},
+	{[]string{"tom"}, MidTom},
+	{[]string{"kick", "bass", "bd"}, Kick},
+	{[]string{"clap"}, Clap},
+	{[]string{"snare", "sd"}, Snare},
+	{[]string{"rim"}, Rim},
+	{[]string{"bell"}, Cowbell},
+	{[]string{"open", "ohat"}, OpenHat},
+	{[]string{"hat", "hh"}, ClosedHat},
+	{[]string{"crash", "cymbal"}, Crash},
+	{[]string{"ride"}, Ride},
+	{[]string{"maraca", "shaker", "cabasa"}, Shaker},
+}
+
+// Classify returns the kind of drum a track name is that of, such as
+// ClosedHat for "hh-close", "clhat" or "Closed Hi-Hat", or Unknown.
+func Classify(name string) Kind {
+	name = Normalize(name)
+	for _, k := range kindKeywords {
+		for _, w := range k.words {
+			if strings.Contains(name, w) {
+				return k.kind
+			}
+		}
+	}
+	return Unknown
+}
+
+// Hat reports whether the kind is a hi-hat.
+func (k Kind) Hat() bool {
+	return k == ClosedHat || k == OpenHat
+}
+
+// Normalize returns a track name with everything but letters and digits
+// removed and in lower case, so that "hh-open", "HH Open" and "hhopen"
+// are the same name.
+func Normalize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,303 @@
+package midi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/rubyist/drum"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// importVersion is the hardware version given to imported patterns.
+const importVersion = "0.808-alpha"
+
+// ErrNoDrums is returned when a MIDI file has no notes on the drum channel.
+var ErrNoDrums = errors.New("midi: no notes on the drum channel")
+
+// DecodeFile reads the MIDI file found at the provided path and returns
+// the patterns played on its drum channel.
+func DecodeFile(path string, opts *Options) ([]*drum.Pattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Decode(file, opts)
+}
+
+// Decode reads a Standard MIDI File from r and returns the patterns played
+// on its drum channel, channel 10. Note ons are quantized to a grid of
+// opts.StepsPerBeat steps per quarter note and cut into patterns of
+// opts.Length steps, each taking the tempo in effect where it starts.
+// Every pattern has a track for each note used in the file, named and
+// numbered by opts.Notes.
+func Decode(r io.Reader, opts *Options) ([]*drum.Pattern, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	notes := opts.Notes
+	if notes == nil {
+		notes = DefaultNoteMap()
+	}
+	beat := opts.StepsPerBeat
+	if beat <= 0 {
+		beat = 4
+	}
+
+	f, err := readFile(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	if len(f.hits) == 0 {
+		return nil, ErrNoDrums
+	}
+
+	length := opts.Length
+	if length <= 0 {
+		length = 4 * beat
+		if len(f.signatures) > 0 && f.signatures[0].tick == 0 {
+			s := f.signatures[0]
+			length = int(math.Max(1, math.Floor(float64(s.num)*4/float64(s.den)*float64(beat)+0.5)))
+		}
+	}
+
+	// Quantize the hits, keeping the loudest where two land on one step
+	stepTicks := float64(f.division) / float64(beat)
+	type key struct {
+		note uint8
+		step int
+	}
+	velocities := make(map[key]uint8)
+	var used []uint8
+	seen := make(map[uint8]bool)
+	last := 0
+	for _, h := range f.hits {
+		step := int(math.Floor(float64(h.tick)/stepTicks + 0.5))
+		k := key{h.note, step}
+		if h.velocity > velocities[k] {
+			velocities[k] = h.velocity
+		}
+		if !seen[h.note] {
+			seen[h.note] = true
+			used = append(used, h.note)
+		}
+		if step > last {
+			last = step
+		}
+	}
+
+	var patterns []*drum.Pattern
+	for start := 0; start <= last; start += length {
+		p := &drum.Pattern{
+			Version:      importVersion,
+			Tempo:        f.tempoAt(int(float64(start) * stepTicks)),
+			Length:       length,
+			StepsPerBeat: beat,
+		}
+		for _, note := range used {
+			id, name := notes.track(note)
+			steps := make([]drum.Step, length)
+			for i := range steps {
+				steps[i].Velocity = velocities[key{note, start + i}]
+			}
+			p.Tracks = append(p.Tracks, &drum.Track{ID: id, Name: name, Steps: steps})
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+type hit struct {
+	tick     int
+	note     uint8
+	velocity uint8
+}
+
+type tempoChange struct {
+	tick int
+	bpm  float32
+}
+
+type signature struct {
+	tick     int
+	num, den int
+}
+
+// file holds what Decode needs from a MIDI file, with every track merged.
+type file struct {
+	division   int
+	hits       []hit
+	tempos     []tempoChange
+	signatures []signature
+}
+
+// tempoAt returns the tempo in effect at tick, 120 BPM if none is set.
+func (f *file) tempoAt(tick int) float32 {
+	bpm := float32(120)
+	for _, t := range f.tempos {
+		if t.tick > tick {
+			break
+		}
+		bpm = t.bpm
+	}
+	return bpm
+}
+
+func readFile(r *bufio.Reader) (*file, error) {
+	id, data, err := readChunk(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != "MThd" || len(data) < 6 {
+		return nil, errors.New("midi: not a MIDI file")
+	}
+	tracks := int(binary.BigEndian.Uint16(data[2:4]))
+	division := binary.BigEndian.Uint16(data[4:6])
+	if division&0x8000 != 0 || division == 0 {
+		return nil, errors.New("midi: SMPTE time divisions aren't supported")
+	}
+
+	f := &file{division: int(division)}
+	for n := 0; n < tracks; {
+		id, data, err := readChunk(r)
+		if err != nil {
+			return nil, err
+		}
+		// Chunks of other types are to be skipped
+		if id != "MTrk" {
+			continue
+		}
+		if err := f.readTrack(data); err != nil {
+			return nil, fmt.Errorf("midi: track %d: %v", n, err)
+		}
+		n++
+	}
+
+	sort.SliceStable(f.hits, func(i, j int) bool { return f.hits[i].tick < f.hits[j].tick })
+	sort.SliceStable(f.tempos, func(i, j int) bool { return f.tempos[i].tick < f.tempos[j].tick })
+	sort.SliceStable(f.signatures, func(i, j int) bool { return f.signatures[i].tick < f.signatures[j].tick })
+	return f, nil
+}
+
+func readChunk(r io.Reader) (string, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errors.New("midi: file ends early")
+		}
+		return "", nil, err
+	}
+
+	var data bytes.Buffer
+	if _, err := io.CopyN(&data, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+		if err == io.EOF {
+			err = errors.New("midi: file ends early")
+		}
+		return "", nil, err
+	}
+	return string(header[:4]), data.Bytes(), nil
+}
+
+var errTruncatedTrack = errors.New("track ends in the middle of an event")
+
+// readTrack reads the events of one MTrk chunk, keeping the ones that
+// matter to drum patterns.
+func (f *file) readTrack(data []byte) error {
+	tick := 0
+	var status byte
+	for len(data) > 0 {
+		delta, n := readVarint(data)
+		if n == 0 {
+			return errTruncatedTrack
+		}
+		tick += delta
+		data = data[n:]
+		if len(data) == 0 {
+			return errTruncatedTrack
+		}
+
+		// Running status reuses the last status for data bytes
+		if data[0]&0x80 != 0 {
+			status = data[0]
+			data = data[1:]
+		} else if status == 0 {
+			return errors.New("data byte without a status")
+		}
+
+		switch {
+		case status == metaEvent:
+			if len(data) < 1 {
+				return errTruncatedTrack
+			}
+			kind := data[0]
+			length, n := readVarint(data[1:])
+			if n == 0 || len(data) < 1+n+length {
+				return errTruncatedTrack
+			}
+			body := data[1+n : 1+n+length]
+			data = data[1+n+length:]
+
+			switch kind {
+			case metaEndOfTrack:
+				return nil
+			case metaTempo:
+				if len(body) == 3 {
+					us := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+					if us > 0 {
+						f.tempos = append(f.tempos, tempoChange{tick, float32(60000000 / float64(us))})
+					}
+				}
+			case metaTimeSignature:
+				if len(body) >= 2 && body[0] > 0 && body[1] < 8 {
+					f.signatures = append(f.signatures, signature{tick, int(body[0]), 1 << body[1]})
+				}
+			}
+			status = 0
+
+		case status == 0xf0 || status == 0xf7:
+			length, n := readVarint(data)
+			if n == 0 || len(data) < n+length {
+				return errTruncatedTrack
+			}
+			data = data[n+length:]
+			status = 0
+
+		default:
+			size := 2
+			if status&0xf0 == 0xc0 || status&0xf0 == 0xd0 {
+				size = 1
+			}
+			if len(data) < size {
+				return errTruncatedTrack
+			}
+			if status == noteOn|drumChannel && data[1] > 0 {
+				f.hits = append(f.hits, hit{tick, data[0] & 0x7f, data[1] & 0x7f})
+			}
+			data = data[size:]
+		}
+	}
+	return nil
+}
+
+// readVarint reads a MIDI variable length quantity from the start of data,
+// returning it and the number of bytes it took, or 0 bytes if data ends
+// first.
+func readVarint(data []byte) (int, int) {
+	v := 0
+	for i, b := range data {
+		if i == 4 {
+			break
+		}
+		v = v<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,113 @@
+package midi
+
+import (
+	"bytes"
+	"github.com/rubyist/drum"
+	"math"
+	"path"
+	"testing"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice"} {
+		pattern, err := drum.DecodeFile(path.Join("..", "fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, format := range []int{0, 1} {
+			var buf bytes.Buffer
+			if err := EncodeTo(&buf, &Options{Format: format}, pattern, pattern); err != nil {
+				t.Fatalf("%s: something went wrong encoding - %v", name, err)
+			}
+
+			patterns, err := Decode(&buf, nil)
+			if err != nil {
+				t.Fatalf("%s: something went wrong decoding - %v", name, err)
+			}
+			if len(patterns) != 2 {
+				t.Fatalf("%s: expected 2 patterns, got %d", name, len(patterns))
+			}
+
+			for _, p := range patterns {
+				if math.Abs(float64(p.Tempo-pattern.Tempo)) > 0.01 {
+					t.Errorf("%s: expected tempo %v, got %v", name, pattern.Tempo, p.Tempo)
+				}
+				compareTracks(t, name, pattern, p)
+			}
+		}
+	}
+}
+
+// compareTracks checks that each track of expected with a hit is in got
+// with the same steps, matching them up by note.
+func compareTracks(t *testing.T, name string, expected, got *drum.Pattern) {
+	notes := DefaultNoteMap()
+	byNote := make(map[uint8]*drum.Track)
+	for _, track := range got.Tracks {
+		note, _ := notes.Note(track)
+		byNote[note] = track
+	}
+
+	for _, track := range expected.Tracks {
+		note, _ := notes.Note(track)
+		g, ok := byNote[note]
+		if !ok {
+			if hasHits(track) {
+				t.Errorf("%s: track %s is missing", name, track.Name)
+			}
+			continue
+		}
+		for i, step := range track.Steps {
+			if g.Steps[i] != step {
+				t.Errorf("%s: got %q, expected %q", name, g, track)
+				break
+			}
+		}
+	}
+}
+
+func hasHits(t *drum.Track) bool {
+	for _, s := range t.Steps {
+		if s.Hit() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDecodeQuantize(t *testing.T) {
+	// A format 0 file at 96 ticks per quarter with a kick on the beat,
+	// a snare a few ticks late, a ghost note and a 90 BPM tempo
+	file := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96,
+		'M', 'T', 'r', 'k', 0, 0, 0, 30,
+		0x00, 0xff, 0x51, 0x03, 0x0a, 0x2c, 0x2a, // 666666us
+		0x00, 0x99, 36, 100,
+		0x32, 38, 127, // running status, tick 50
+		0x00, 0x89, 36, 0,
+		0x20, 0x99, 38, 20, // tick 82
+		0x00, 0x89, 38, 0,
+		0x00, 0xff, 0x2f, 0x00,
+	}
+
+	patterns, err := Decode(bytes.NewReader(file), &Options{Length: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patterns) != 1 {
+		t.Fatalf("expected 1 pattern, got %d", len(patterns))
+	}
+
+	p := patterns[0]
+	if math.Abs(float64(p.Tempo-90)) > 0.01 {
+		t.Errorf("expected tempo 90, got %v", p.Tempo)
+	}
+	expected := "(36) kick\t|x---|----|\n(38) snare\t|--xx|----|\n"
+	if got := p.Tracks[0].String() + p.Tracks[1].String(); got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+	if v := p.Tracks[1].Steps[3].Velocity; v != 20 {
+		t.Errorf("expected a ghost note of velocity 20, got %d", v)
+	}
+}
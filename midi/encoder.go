@@ -0,0 +1,249 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/rubyist/drum"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Options configures how patterns are written as and read from
+// MIDI files.
+type Options struct {
+	// Format is the Standard MIDI File format to write. Format 0 puts
+	// every event in one track; format 1 writes the tempo map in the
+	// first track and gives each drum track its own MIDI track.
+	Format int
+
+	// Division is the number of ticks per quarter note to write. Zero
+	// means DefaultDivision.
+	Division int
+
+	// Notes chooses the note played by each track. Nil means
+	// DefaultNoteMap. Tracks without a note are left out when writing.
+	Notes *NoteMap
+
+	// StepsPerBeat is the number of steps per quarter note that notes
+	// are quantized to when reading. Zero means 4.
+	StepsPerBeat int
+
+	// Length is the number of steps in each pattern read. Zero means a
+	// bar of the file's first time signature, or of 4/4 if it has none.
+	Length int
+}
+
+// Encode writes the patterns, one after another, to a MIDI file at the
+// provided path.
+func Encode(path string, opts *Options, patterns ...*drum.Pattern) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := EncodeTo(file, opts, patterns...); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// EncodeTo writes the patterns, one after another, to w as a Standard
+// MIDI File.
+func EncodeTo(w io.Writer, opts *Options, patterns ...*drum.Pattern) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Format != 0 && opts.Format != 1 {
+		return errors.New("midi: format must be 0 or 1")
+	}
+	division := opts.Division
+	if division <= 0 {
+		division = DefaultDivision
+	}
+	if division > 0x7fff {
+		return errors.New("midi: division must be less than 32768 ticks")
+	}
+	notes := opts.Notes
+	if notes == nil {
+		notes = DefaultNoteMap()
+	}
+
+	// Lay the patterns out end to end
+	conductor := &track{}
+	var tracks []*track
+	byKey := make(map[trackKey]*track)
+	var start int
+	for _, p := range patterns {
+		if tempo := float64(p.Tempo); !(tempo > 0) || math.IsInf(tempo, 0) || 60000000/tempo > maxTempo {
+			return fmt.Errorf("midi: can't encode a pattern at a tempo of %v BPM", p.Tempo)
+		}
+		conductor.tempo(start, p.Tempo)
+		if num, den, ok := timeSignature(p); ok {
+			conductor.timeSignature(start, num, den)
+		}
+
+		length, beat := p.StepCount(), p.BeatSize()
+		for _, t := range p.Tracks {
+			note, ok := notes.Note(t)
+			if !ok {
+				continue
+			}
+
+			key := trackKey{t.ID, t.Name}
+			mt, ok := byKey[key]
+			if !ok {
+				mt = &track{}
+				if opts.Format == 1 {
+					mt.name(t.Name)
+				}
+				byKey[key] = mt
+				tracks = append(tracks, mt)
+			}
+
+			for i, step := range t.Steps {
+				if !step.Hit() || i >= length {
+					continue
+				}
+				on := start + i*division/beat
+				// Steps shorter than a tick still last one, so that their
+				// note off doesn't sort ahead of the note on
+				off := max(start+(i+1)*division/beat, on+1)
+				// MIDI data bytes only have seven bits
+				mt.note(on, off, note, min(step.Velocity, drum.MaxVelocity))
+			}
+		}
+		start += length * division / beat
+	}
+
+	if opts.Format == 0 {
+		for _, t := range tracks {
+			conductor.events = append(conductor.events, t.events...)
+		}
+		tracks = nil
+	}
+	tracks = append([]*track{conductor}, tracks...)
+
+	var buf bytes.Buffer
+	buf.WriteString("MThd")
+	binary.Write(&buf, binary.BigEndian, uint32(6))
+	binary.Write(&buf, binary.BigEndian, uint16(opts.Format))
+	binary.Write(&buf, binary.BigEndian, uint16(len(tracks)))
+	binary.Write(&buf, binary.BigEndian, uint16(division))
+
+	for _, t := range tracks {
+		t.write(&buf, start)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// timeSignature describes a pattern as a time signature, if it can be.
+// A beat is a quarter note, so 16 steps of 4 is 4/4 and 7 steps of 2 is
+// 7/8.
+func timeSignature(p *drum.Pattern) (num, den int, ok bool) {
+	length, beat := p.StepCount(), p.BeatSize()
+	if length%beat == 0 {
+		return length / beat, 4, length/beat < 256
+	}
+	den = 4 * beat
+	return length, den, den&(den-1) == 0 && length < 256
+}
+
+type trackKey struct {
+	id   int32
+	name string
+}
+
+type event struct {
+	tick int
+	data []byte
+}
+
+// track collects the events of one MIDI track.
+type track struct {
+	events []event
+}
+
+func (t *track) add(tick int, data ...byte) {
+	t.events = append(t.events, event{tick, data})
+}
+
+func (t *track) name(name string) {
+	t.add(0, append(meta(metaTrackName, len(name)), name...)...)
+}
+
+func (t *track) tempo(tick int, bpm float32) {
+	us := uint32(60000000 / bpm)
+	t.add(tick, append(meta(metaTempo, 3), byte(us>>16), byte(us>>8), byte(us))...)
+}
+
+func (t *track) timeSignature(tick, num, den int) {
+	power := 0
+	for 1<<uint(power) < den {
+		power++
+	}
+	// 24 MIDI clocks per metronome click, 8 32nd notes per quarter
+	t.add(tick, append(meta(metaTimeSignature, 4), byte(num), byte(power), 24, 8)...)
+}
+
+func (t *track) note(on, off int, note, velocity uint8) {
+	t.add(on, noteOn|drumChannel, note, velocity)
+	t.add(off, noteOff|drumChannel, note, 0)
+}
+
+// write writes the track as an MTrk chunk ending at the end tick.
+func (t *track) write(w *bytes.Buffer, end int) {
+	// Note offs sort ahead of anything else at the same tick, so that
+	// a note ending on the step where it is played again isn't cut short.
+	sort.SliceStable(t.events, func(i, j int) bool {
+		a, b := t.events[i], t.events[j]
+		if a.tick != b.tick {
+			return a.tick < b.tick
+		}
+		return a.data[0]&0xf0 == noteOff && b.data[0]&0xf0 != noteOff
+	})
+
+	var data bytes.Buffer
+	tick := 0
+	for _, e := range t.events {
+		writeVarint(&data, e.tick-tick)
+		data.Write(e.data)
+		tick = e.tick
+	}
+	if end < tick {
+		end = tick
+	}
+	writeVarint(&data, end-tick)
+	data.Write(meta(metaEndOfTrack, 0))
+
+	w.WriteString("MTrk")
+	binary.Write(w, binary.BigEndian, uint32(data.Len()))
+	w.Write(data.Bytes())
+}
+
+func meta(kind byte, length int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(metaEvent)
+	buf.WriteByte(kind)
+	writeVarint(&buf, length)
+	return buf.Bytes()
+}
+
+// writeVarint writes n as a MIDI variable length quantity, 7 bits a byte
+// with the high bit set on all but the last.
+func writeVarint(w *bytes.Buffer, n int) {
+	var b [5]byte
+	i := len(b) - 1
+	b[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		b[i] = byte(n&0x7f) | 0x80
+	}
+	w.Write(b[i:])
+}
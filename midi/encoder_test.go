@@ -0,0 +1,139 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/rubyist/drum"
+	"io/ioutil"
+	"math"
+	"path"
+	"testing"
+)
+
+func TestEncodeHeader(t *testing.T) {
+	pattern, err := drum.DecodeFile(path.Join("..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tData := []struct {
+		format int
+		tracks int
+	}{
+		{0, 1},
+		{1, 7},
+	}
+
+	for _, exp := range tData {
+		var buf bytes.Buffer
+		if err := EncodeTo(&buf, &Options{Format: exp.format}, pattern); err != nil {
+			t.Fatalf("format %d: something went wrong encoding - %v", exp.format, err)
+		}
+
+		data := buf.Bytes()
+		if string(data[:4]) != "MThd" || binary.BigEndian.Uint32(data[4:8]) != 6 {
+			t.Fatalf("format %d: bad header %x", exp.format, data[:8])
+		}
+		format := binary.BigEndian.Uint16(data[8:10])
+		tracks := binary.BigEndian.Uint16(data[10:12])
+		division := binary.BigEndian.Uint16(data[12:14])
+		if int(format) != exp.format || int(tracks) != exp.tracks || division != DefaultDivision {
+			t.Errorf("format %d: got format %d, %d tracks, division %d", exp.format, format, tracks, division)
+		}
+
+		// 120 BPM is 500000 microseconds per quarter note
+		if !bytes.Contains(data, []byte{0xff, 0x51, 0x03, 0x07, 0xa1, 0x20}) {
+			t.Errorf("format %d: no 120 BPM tempo event", exp.format)
+		}
+	}
+}
+
+func TestNoteMap(t *testing.T) {
+	notes := DefaultNoteMap()
+	if err := notes.Set("99=69"); err != nil {
+		t.Fatal(err)
+	}
+	if err := notes.Set("Low Conga=62"); err != nil {
+		t.Fatal(err)
+	}
+
+	tData := []struct {
+		track drum.Track
+		note  uint8
+		ok    bool
+	}{
+		{drum.Track{ID: 0, Name: "kick"}, 36, true},
+		{drum.Track{ID: 3, Name: "hh-open"}, 46, true},
+		{drum.Track{ID: 4, Name: "hh-close"}, 42, true},
+		{drum.Track{ID: 0, Name: "SubKick"}, 35, true},
+		{drum.Track{ID: 2, Name: "HiHat"}, 42, true},
+		{drum.Track{ID: 99, Name: "Maracas"}, 69, true},
+		{drum.Track{ID: 255, Name: "Low Conga"}, 62, true},
+		{drum.Track{ID: 7, Name: "laser"}, 0, false},
+	}
+
+	for _, exp := range tData {
+		note, ok := notes.Note(&exp.track)
+		if note != exp.note || ok != exp.ok {
+			t.Errorf("%s: got %d %v, expected %d %v", exp.track.Name, note, ok, exp.note, exp.ok)
+		}
+	}
+
+	if err := notes.Set("kick"); err == nil {
+		t.Error("expected an error for an entry without a note")
+	}
+	if err := notes.Set("kick=128"); err == nil {
+		t.Error("expected an error for a note out of range")
+	}
+}
+
+func TestEncodeVelocity(t *testing.T) {
+	steps := make([]drum.Step, 16)
+	steps[0].Velocity = 200
+	pattern := &drum.Pattern{
+		Tempo:  120,
+		Tracks: []*drum.Track{{ID: 0, Name: "kick", Steps: steps}},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeTo(&buf, &Options{}, pattern); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte{0x99, 36, drum.MaxVelocity}) {
+		t.Errorf("expected a kick at full velocity, got %x", buf.Bytes())
+	}
+}
+
+func TestEncodeBadTempo(t *testing.T) {
+	tempos := []float32{0, -120, 3.5, float32(math.Inf(1)), float32(math.NaN())}
+	for _, tempo := range tempos {
+		pattern := &drum.Pattern{
+			Tempo:  tempo,
+			Tracks: []*drum.Track{{ID: 0, Name: "kick", Steps: make([]drum.Step, 16)}},
+		}
+		if err := EncodeTo(ioutil.Discard, &Options{}, pattern); err == nil {
+			t.Errorf("expected a tempo of %v to be refused", tempo)
+		}
+	}
+}
+
+func TestEncodeShortSteps(t *testing.T) {
+	// Steps of half a tick at the default division
+	steps := make([]drum.Step, 2*DefaultDivision)
+	steps[0].Velocity = drum.MaxVelocity
+	pattern := &drum.Pattern{
+		Tempo:        120,
+		Length:       len(steps),
+		StepsPerBeat: len(steps),
+		Tracks:       []*drum.Track{{ID: 0, Name: "kick", Steps: steps}},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeTo(&buf, &Options{}, pattern); err != nil {
+		t.Fatalf("something went wrong encoding - %v", err)
+	}
+	on, off := bytes.Index(buf.Bytes(), []byte{0x99, 36}), bytes.Index(buf.Bytes(), []byte{0x89, 36})
+	if on < 0 || off < on {
+		t.Errorf("expected the note on ahead of its note off, got %x", buf.Bytes())
+	}
+}
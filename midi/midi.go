@@ -0,0 +1,28 @@
+// Package midi converts drum patterns to and from Standard MIDI Files.
+//
+// A pattern's beat is written as a MIDI quarter note and its tracks are
+// played on channel 10, the General MIDI percussion channel, using a
+// NoteMap to choose the note for each track.
+package midi
+
+const (
+	// DefaultDivision is the number of ticks per quarter note used when
+	// writing files. It divides evenly into beats of 1, 2, 3, 4, 6 and 8
+	// steps.
+	DefaultDivision = 96
+
+	drumChannel = 9 // channel 10, counting from zero
+
+	// maxTempo is the most microseconds per quarter note that a tempo
+	// event can hold, the slowest tempo a file can have.
+	maxTempo = 0xffffff
+
+	noteOff   = 0x80
+	noteOn    = 0x90
+	metaEvent = 0xff
+
+	metaTrackName     = 0x03
+	metaEndOfTrack    = 0x2f
+	metaTempo         = 0x51
+	metaTimeSignature = 0x58
+)
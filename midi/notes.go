@@ -0,0 +1,251 @@
+package midi
+
+import (
+	"fmt"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/kit"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NoteMap chooses the General MIDI drum note played by a track. Tracks
+// are looked up by ID first, then by name, then by keywords in their name
+// such as "kick" or "hat".
+//
+// NoteMap implements flag.Value so that entries can be given on the
+// command line as "id=note" or "name=note".
+type NoteMap struct {
+	IDs   map[int32]uint8
+	Names map[string]uint8 // keys are lowercase letters and digits, see Set
+}
+
+// gmNames are the General MIDI percussion notes, plus the names used by
+// the patterns and samples that come with this package.
+var gmNames = map[string]uint8{
+	"acousticbassdrum": 35,
+	"subkick":          35,
+	"bassdrum":         36,
+	"kick":             36,
+	"sidestick":        37,
+	"rimshot":          37,
+	"acousticsnare":    38,
+	"snare":            38,
+	"handclap":         39,
+	"clap":             39,
+	"electricsnare":    40,
+	"lowfloortom":      41,
+	"closedhihat":      42,
+	"hhclose":          42,
+	"clhat":            42,
+	"highfloortom":     43,
+	"pedalhihat":       44,
+	"lowtom":           45,
+	"openhihat":        46,
+	"hhopen":           46,
+	"ohat":             46,
+	"lowmidtom":        47,
+	"midtom":           47,
+	"himidtom":         48,
+	"crashcymbal":      49,
+	"crash":            49,
+	"hightom":          50,
+	"hitom":            50,
+	"ridecymbal":       51,
+	"ride":             51,
+	"chinesecymbal":    52,
+	"ridebell":         53,
+	"tambourine":       54,
+	"splashcymbal":     55,
+	"cowbell":          56,
+	"vibraslap":        58,
+	"hibongo":          60,
+	"lowbongo":         61,
+	"mutehiconga":      62,
+	"openhiconga":      63,
+	"hiconga":          63,
+	"lowconga":         64,
+	"hightimbale":      65,
+	"lowtimbale":       66,
+	"cabasa":           69,
+	"maracas":          70,
+	"shortwhistle":     71,
+	"longwhistle":      72,
+	"shortguiro":       73,
+	"longguiro":        74,
+	"claves":           75,
+	"clave":            75,
+	"hiwoodblock":      76,
+	"lowwoodblock":     77,
+}
+
+// gmTracks names the General MIDI percussion notes as tracks, in the style
+// of the pattern files, for tracks made from MIDI notes.
+var gmTracks = map[uint8]string{
+	35: "acoustic-bass-drum",
+	36: "kick",
+	37: "side-stick",
+	38: "snare",
+	39: "clap",
+	40: "electric-snare",
+	41: "low-floor-tom",
+	42: "hh-close",
+	43: "high-floor-tom",
+	44: "hh-pedal",
+	45: "low-tom",
+	46: "hh-open",
+	47: "mid-tom",
+	48: "hi-mid-tom",
+	49: "crash",
+	50: "hi-tom",
+	51: "ride",
+	52: "chinese-cymbal",
+	53: "ride-bell",
+	54: "tambourine",
+	55: "splash",
+	56: "cowbell",
+	57: "crash-2",
+	58: "vibraslap",
+	59: "ride-2",
+	60: "hi-bongo",
+	61: "low-bongo",
+	62: "mute-hi-conga",
+	63: "hi-conga",
+	64: "low-conga",
+	65: "hi-timbale",
+	66: "low-timbale",
+	67: "hi-agogo",
+	68: "low-agogo",
+	69: "cabasa",
+	70: "maracas",
+	71: "short-whistle",
+	72: "long-whistle",
+	73: "short-guiro",
+	74: "long-guiro",
+	75: "claves",
+	76: "hi-wood-block",
+	77: "low-wood-block",
+	78: "mute-cuica",
+	79: "open-cuica",
+	80: "mute-triangle",
+	81: "open-triangle",
+}
+
+// gmKinds are the notes of the kinds of drum that names not in gmNames
+// are classified as by the kit package.
+var gmKinds = map[kit.Kind]uint8{
+	kit.Kick:      36,
+	kit.Snare:     38,
+	kit.Clap:      39,
+	kit.Rim:       37,
+	kit.LowTom:    45,
+	kit.MidTom:    47,
+	kit.HiTom:     50,
+	kit.LowConga:  64,
+	kit.Conga:     63,
+	kit.Bongo:     60,
+	kit.ClosedHat: 42,
+	kit.OpenHat:   46,
+	kit.Crash:     49,
+	kit.Ride:      51,
+	kit.Cowbell:   56,
+	kit.Shaker:    70,
+}
+
+// DefaultNoteMap returns a NoteMap that knows the General MIDI drum names.
+func DefaultNoteMap() *NoteMap {
+	m := &NoteMap{
+		IDs:   make(map[int32]uint8),
+		Names: make(map[string]uint8),
+	}
+	for note, name := range gmTracks {
+		m.Names[kit.Normalize(name)] = note
+	}
+	for name, note := range gmNames {
+		m.Names[name] = note
+	}
+	return m
+}
+
+// Note returns the note for the track, and false if the track couldn't
+// be matched to one.
+func (m *NoteMap) Note(t *drum.Track) (uint8, bool) {
+	if note, ok := m.IDs[t.ID]; ok {
+		return note, true
+	}
+
+	name := kit.Normalize(t.Name)
+	if note, ok := m.Names[name]; ok {
+		return note, true
+	}
+
+	note, ok := gmKinds[kit.Classify(name)]
+	return note, ok
+}
+
+// track returns the ID and name for a track made from note. The ID is
+// the lowest one mapped to the note, or else the note itself, and the
+// name is the note's General MIDI name.
+func (m *NoteMap) track(note uint8) (int32, string) {
+	id, found := int32(note), false
+	for i, n := range m.IDs {
+		if n == note && (!found || i < id) {
+			id, found = i, true
+		}
+	}
+
+	name, ok := gmTracks[note]
+	if !ok {
+		name = fmt.Sprintf("note-%d", note)
+	}
+	return id, name
+}
+
+// Set adds an "id=note" or "name=note" entry to the map. Names are
+// stored with everything but letters and digits removed and in lower
+// case, so that "hh-open", "HH Open" and "hhopen" are the same name.
+func (m *NoteMap) Set(entry string) error {
+	i := strings.LastIndex(entry, "=")
+	if i < 0 {
+		return fmt.Errorf("midi: note map entry %q should be id=note or name=note", entry)
+	}
+	key, value := entry[:i], entry[i+1:]
+
+	note, err := strconv.ParseUint(value, 10, 7)
+	if err != nil {
+		return fmt.Errorf("midi: invalid note %q", value)
+	}
+
+	if id, err := strconv.ParseInt(key, 10, 32); err == nil {
+		if m.IDs == nil {
+			m.IDs = make(map[int32]uint8)
+		}
+		m.IDs[int32(id)] = uint8(note)
+		return nil
+	}
+
+	if m.Names == nil {
+		m.Names = make(map[string]uint8)
+	}
+	m.Names[kit.Normalize(key)] = uint8(note)
+	return nil
+}
+
+// String returns the entries that differ from the General MIDI names
+// in the form accepted by Set.
+func (m *NoteMap) String() string {
+	if m == nil {
+		return ""
+	}
+	var entries []string
+	for id, note := range m.IDs {
+		entries = append(entries, fmt.Sprintf("%d=%d", id, note))
+	}
+	for name, note := range m.Names {
+		if gm, ok := gmNames[name]; !ok || gm != note {
+			entries = append(entries, fmt.Sprintf("%s=%d", name, note))
+		}
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
@@ -1,46 +1,140 @@
 package main
 
 import (
-	"code.google.com/p/portaudio-go/portaudio"
+	"context"
 	"flag"
 	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/audio"
+	"github.com/rubyist/drum/audio/device"
+	"github.com/rubyist/drum/kit"
+	"github.com/rubyist/drum/wav"
 	"log"
-	"time"
+	"os"
+	"os/signal"
 )
 
-var soundDir = flag.String("d", "sounds", "directory containing samples")
+var (
+	soundDir = flag.String("d", "sounds", "directory containing samples named after tracks")
+	kitFile  = flag.String("kit", "", "kit file choosing the samples of tracks, instead of -d")
+	output   = flag.String("o", "", "file written by the wav or pcm output, -o alone renders a wav file")
+	loops    = flag.Int("loops", 0, "number of times to loop the patterns, 0 for forever or once when rendering")
+	bits     = flag.Int("bits", 16, "bits per sample of the wav or pcm output, 16 or 24")
+	dither   = flag.Bool("dither", false, "dither to the bits per sample of the wav or pcm output")
+	gain     = flag.Float64("gain", audio.DefaultGain, "master gain of the mix")
+	ramp     = flag.Int("ramp", 0, "steps over which the tempo glides between patterns, 0 to change at once")
+	swing    = flag.Int("swing", 0, "swing percentage from 50 to 75 played instead of the patterns' own")
+
+	deviceName = flag.String("device", "", "name of the sound device to play through, instead of the default")
+	rate       = flag.Int("rate", audio.DefaultRate, "sample rate, in frames per second")
+	channels   = flag.Int("channels", audio.DefaultChannels, "number of channels, 1 for mono")
+	buffer     = flag.Int("buffer", audio.DefaultBuffer, "frames played at a time")
+	latency    = flag.Duration("latency", 0, "output latency asked of the sound device, instead of its default")
+)
+
+var (
+	// quality is how samples recorded at other rates are resampled.
+	quality wav.Quality
+
+	clipping audio.Clipping
+	missing  audio.Missing
+	sink     audio.Sink
+	stealing audio.Stealing
+)
 
 func main() {
+	flag.Var(&quality, "resample", "resampling of samples at other rates, sinc or linear")
+	flag.Var(&clipping, "clip", "how to keep the mix from clipping, limit, soft or hard")
+	flag.Var(&missing, "missing", "what plays tracks without samples, synth, silence or fail")
+	flag.Var(&sink, "out", "where the patterns are played, device, null, wav or pcm")
+	flag.Var(&stealing, "steal", "hit cut short when all of an instrument's voices play, oldest or quietest")
 	flag.Parse()
 
-	sequencer := NewSequencer()
+	if *swing != 0 && (*swing < drum.MinSwing || *swing > drum.MaxSwing) {
+		log.Fatalf("swing must be from %d to %d, not %d", drum.MinSwing, drum.MaxSwing, *swing)
+	}
+
+	if *output != "" && sink == audio.DeviceSink {
+		sink = audio.WAVSink
+	}
+
+	k := kit.Default(*soundDir)
+	if *kitFile != "" {
+		var err error
+		if k, err = kit.Load(*kitFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	opts := &audio.Options{
+		Config: audio.Config{
+			Device:   *deviceName,
+			Rate:     *rate,
+			Channels: *channels,
+			Buffer:   *buffer,
+			Latency:  *latency,
+		},
+		Kit:      k,
+		Resample: quality,
+		Missing:  missing,
+		Gain:     *gain,
+		Clipping: clipping,
+		Stealing: stealing,
+		Bits:     *bits,
+		Ramp:     *ramp,
+		Swing:    *swing,
+	}
+	if sink != audio.DeviceSink && *dither {
+		opts.Dither = *bits
+	}
+	sequencer := audio.NewSequencer(opts)
 
 	for _, file := range flag.Args() {
 		pattern, err := drum.DecodeFile(file)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if err := sequencer.Add(pattern); err != nil {
+		warnings, err := sequencer.Add(pattern)
+		if err != nil {
 			log.Fatal(err)
 		}
+		for _, w := range warnings {
+			log.Print(w)
+		}
 		log.Print(pattern.String())
 	}
 
-	portaudio.Initialize()
-	defer portaudio.Terminate()
-	stream, err := portaudio.OpenDefaultStream(0, 2, 44100, 0, func(o []int32) {
-		sequencer.Read(o)
-	})
+	if sink == audio.WAVSink {
+		if *loops == 0 {
+			*loops = 1
+		}
+		if err := sequencer.Render(*output, *loops); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var out audio.Output
+	var err error
+	if sink == audio.DeviceSink {
+		out, err = device.Open(sequencer.Config())
+	} else {
+		out, err = audio.OpenOutput(sink, sequencer.Config(), *output, *bits)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer stream.Close()
-	stream.Start()
-	defer stream.Stop()
 
-	sequencer.Start()
+	// Interrupting stops playing, so that outputs are closed and files
+	// finished
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	for {
-		time.Sleep(time.Second)
+	sequencer.Start()
+	err = sequencer.Play(ctx, out, *loops)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil && err != context.Canceled {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,59 @@
+package synth
+
+import "math"
+
+// biquad is a two pole, two zero filter, with coefficients from Robert
+// Bristow-Johnson's audio EQ cookbook.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// highpass returns a filter passing frequencies above freq.
+func highpass(d *Drum, freq, q float64) biquad {
+	cos, alpha := coefficients(d, freq, q)
+	return normalize(biquad{
+		b0: (1 + cos) / 2,
+		b1: -(1 + cos),
+		b2: (1 + cos) / 2,
+		a1: -2 * cos,
+		a2: 1 - alpha,
+	}, 1+alpha)
+}
+
+// bandpass returns a filter passing frequencies around freq, with a
+// peak gain of 1.
+func bandpass(d *Drum, freq, q float64) biquad {
+	cos, alpha := coefficients(d, freq, q)
+	return normalize(biquad{
+		b0: alpha,
+		b2: -alpha,
+		a1: -2 * cos,
+		a2: 1 - alpha,
+	}, 1+alpha)
+}
+
+// coefficients returns the cosine of freq's angular frequency and the
+// alpha of the cookbook. Frequencies that can't be represented at the
+// drum's rate are lowered to just under its Nyquist frequency.
+func coefficients(d *Drum, freq, q float64) (cos, alpha float64) {
+	freq = math.Min(freq, 0.45*d.rate)
+	w := 2 * math.Pi * freq / d.rate
+	return math.Cos(w), math.Sin(w) / (2 * q)
+}
+
+func normalize(b biquad, a0 float64) biquad {
+	b.b0 /= a0
+	b.b1 /= a0
+	b.b2 /= a0
+	b.a1 /= a0
+	b.a2 /= a0
+	return b
+}
+
+func (b *biquad) filter(x float64) float64 {
+	y := b.b0*x + b.b1*b.x1 + b.b2*b.x2 - b.a1*b.y1 - b.a2*b.y2
+	b.x2, b.x1 = b.x1, x
+	b.y2, b.y1 = b.y1, y
+	return y
+}
@@ -0,0 +1,226 @@
+// Package synth synthesizes drum sounds after those of the Roland TR-808,
+// the drum machine the original pattern files were saved from.
+//
+// Each voice is made the way the 808 makes it: kicks and toms are sine
+// waves falling in pitch, the snare mixes two tones with noise, the clap
+// and maracas are filtered noise, the claves a short sine, and the
+// cowbell and hats are filtered square waves.
+package synth
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Params are the settings of a synthesized drum. Like the knobs on an
+// 808 they go from 0 to 1, and 0.5 is a middling setting. Params decoded
+// from JSON start out at 0.5.
+type Params struct {
+	Voice string `json:"voice"` // one of Voices
+
+	Decay  float64 `json:"decay"`  // how long the drum rings
+	Tone   float64 `json:"tone"`   // how bright the drum is, or the pitch of toms
+	Snappy float64 `json:"snappy"` // how loud the snares are, for the snare
+}
+
+// DefaultParams returns the settings of a voice with every knob at 0.5.
+func DefaultParams(voice string) Params {
+	return Params{Voice: voice, Decay: 0.5, Tone: 0.5, Snappy: 0.5}
+}
+
+// UnmarshalJSON decodes params, leaving the knobs that aren't given at 0.5.
+func (p *Params) UnmarshalJSON(data []byte) error {
+	type params Params
+	v := params(DefaultParams(""))
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = Params(v)
+	return nil
+}
+
+// Voices are the names of the drums that can be synthesized.
+var Voices = []string{
+	"kick", "snare", "clap", "low-tom", "mid-tom", "hi-tom",
+	"cowbell", "closed-hat", "open-hat", "maracas", "claves",
+}
+
+// hatFreqs are the frequencies of the six square waves of the 808's
+// hats and cymbal.
+var hatFreqs = [6]float64{205.3, 304.4, 369.6, 522.7, 540, 800}
+
+// tomFreqs are the frequencies of the toms with their tone at 0.5.
+var tomFreqs = map[string]float64{"low-tom": 80, "mid-tom": 120, "hi-tom": 170}
+
+// Drum synthesizes the hits of one voice.
+type Drum struct {
+	params Params
+	rate   float64
+	pitch  float64 // multiplies the voice's frequencies
+	length int     // samples in a hit
+
+	filters [2]biquad
+}
+
+// New returns a drum playing the voice in p at rate samples per second,
+// tuned by tune semitones.
+func New(p Params, rate int, tune float64) (*Drum, error) {
+	d := &Drum{
+		params: p,
+		rate:   float64(rate),
+		pitch:  math.Pow(2, tune/12),
+	}
+	for _, k := range []*float64{&d.params.Decay, &d.params.Tone, &d.params.Snappy} {
+		*k = math.Max(0, math.Min(*k, 1))
+	}
+	decay, tone := d.params.Decay, d.params.Tone
+
+	// The time for the longest envelope to fall to -60dB
+	var ring float64
+	switch p.Voice {
+	case "kick":
+		ring = 0.05 + 0.75*decay
+	case "low-tom", "mid-tom", "hi-tom":
+		ring = 0.08 + 0.4*decay
+	case "snare":
+		ring = 0.04 + 0.2*decay
+		d.filters[0] = highpass(d, 1200, 0.7)
+	case "clap":
+		ring = 0.03 + 0.05 + 0.3*decay // the tail follows 30ms of bursts
+		d.filters[0] = bandpass(d, 800+800*tone, 1.5)
+	case "cowbell":
+		ring = 0.05 + 0.4*decay
+		d.filters[0] = bandpass(d, 2000+1200*tone, 2)
+	case "closed-hat":
+		ring = 0.01 + 0.06*decay
+		d.filters[0] = bandpass(d, 10000, 1)
+		d.filters[1] = highpass(d, 5000+4000*tone, 0.7)
+	case "open-hat":
+		ring = 0.1 + 0.7*decay
+		d.filters[0] = bandpass(d, 10000, 1)
+		d.filters[1] = highpass(d, 5000+4000*tone, 0.7)
+	case "maracas":
+		ring = 0.01 + 0.04*decay
+		d.filters[0] = highpass(d, 5000+3000*tone, 0.7)
+	case "claves":
+		ring = 0.02 + 0.08*decay
+	default:
+		return nil, fmt.Errorf("synth: unknown voice %q", p.Voice)
+	}
+	d.length = int(ring * d.rate)
+	return d, nil
+}
+
+// Voice is one hit of a Drum. Voices are started by Drum.Start and can
+// be used again once finished.
+type Voice struct {
+	n       int // samples since the hit
+	phase   [6]float64
+	filters [2]biquad
+	noise   uint32
+}
+
+// Start starts v playing a hit from the beginning.
+func (d *Drum) Start(v *Voice) {
+	*v = Voice{filters: d.filters, noise: 0x2545f491}
+}
+
+// Next returns the next sample of a hit, from -1 to 1, and false once
+// the hit has died away.
+func (d *Drum) Next(v *Voice) (float64, bool) {
+	if v.n >= d.length {
+		return 0, false
+	}
+	t := float64(v.n) / d.rate
+	v.n++
+
+	decay, tone := d.params.Decay, d.params.Tone
+	var out float64
+	switch d.params.Voice {
+	case "kick":
+		// A sine that bends down into its pitch, with a click of noise
+		// for the beater that tone brings up
+		freq := 49 * d.pitch * (1 + 0.6*math.Exp(-t/0.015))
+		out = 0.9 * d.sine(v, 0, freq) * envelope(t, 0.05+0.75*decay)
+		out += 0.3 * tone * v.white() * math.Exp(-t/0.001)
+
+	case "low-tom", "mid-tom", "hi-tom":
+		freq := tomFreqs[d.params.Voice] * d.pitch * (0.75 + 0.5*tone) * (1 + 0.3*math.Exp(-t/0.02))
+		out = 0.85 * d.sine(v, 0, freq) * envelope(t, 0.08+0.4*decay)
+		out += 0.1 * v.white() * math.Exp(-t/0.02)
+
+	case "snare":
+		// Two drum heads, tone leaning towards the higher, under the
+		// snares' noise
+		heads := (1-tone)*d.sine(v, 0, 180*d.pitch) + tone*d.sine(v, 1, 330*d.pitch)
+		snares := v.filters[0].filter(v.white())
+		out = 0.5*heads*envelope(t, 0.02+0.15*decay) + 0.9*d.params.Snappy*snares*envelope(t, 0.04+0.2*decay)
+
+	case "clap":
+		// Three quick bursts of noise and a longer tail, as of several
+		// hands
+		var env float64
+		switch {
+		case t < 0.03:
+			env = math.Exp(-math.Mod(t, 0.01) / 0.003)
+		default:
+			env = 0.8 * envelope(t-0.03, 0.05+0.3*decay)
+		}
+		out = 2.5 * v.filters[0].filter(v.white()) * env
+
+	case "cowbell":
+		square := d.square(v, 0, 540*d.pitch) + d.square(v, 1, 800*d.pitch)
+		env := 0.6*math.Exp(-t/0.01) + 0.4*envelope(t, 0.05+0.4*decay)
+		out = 0.9 * v.filters[0].filter(square) * env
+
+	case "closed-hat", "open-hat":
+		var metal float64
+		for i, f := range hatFreqs {
+			metal += d.square(v, i, f*d.pitch)
+		}
+		metal = v.filters[1].filter(v.filters[0].filter(metal / 6))
+		ring := 0.01 + 0.06*decay
+		if d.params.Voice == "open-hat" {
+			ring = 0.1 + 0.7*decay
+		}
+		out = 2.5 * metal * envelope(t, ring)
+
+	case "maracas":
+		attack := math.Min(1, t/0.002)
+		out = 1.5 * v.filters[0].filter(v.white()) * attack * envelope(t, 0.01+0.04*decay)
+
+	case "claves":
+		out = 0.8 * d.sine(v, 0, 2500*d.pitch*(0.8+0.4*tone)) * envelope(t, 0.02+0.08*decay)
+	}
+	return math.Max(-1, math.Min(out, 1)), true
+}
+
+// envelope falls from 1 to -60dB over ring seconds.
+func envelope(t, ring float64) float64 {
+	return math.Exp(-t * math.Log(1000) / ring)
+}
+
+func (d *Drum) sine(v *Voice, osc int, freq float64) float64 {
+	v.phase[osc] += freq / d.rate
+	v.phase[osc] -= math.Floor(v.phase[osc])
+	return math.Sin(2 * math.Pi * v.phase[osc])
+}
+
+func (d *Drum) square(v *Voice, osc int, freq float64) float64 {
+	v.phase[osc] += freq / d.rate
+	v.phase[osc] -= math.Floor(v.phase[osc])
+	if v.phase[osc] < 0.5 {
+		return 1
+	}
+	return -1
+}
+
+// white returns white noise from an xorshift generator, the same for
+// every hit as it would be for a sample.
+func (v *Voice) white() float64 {
+	v.noise ^= v.noise << 13
+	v.noise ^= v.noise >> 17
+	v.noise ^= v.noise << 5
+	return float64(v.noise)/math.MaxUint32*2 - 1
+}
@@ -0,0 +1,90 @@
+package synth
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// hit plays a hit of d through, returning its length in seconds and its
+// peak level.
+func hit(d *Drum) (length, peak float64) {
+	var v Voice
+	d.Start(&v)
+	n := 0
+	for {
+		x, ok := d.Next(&v)
+		if !ok {
+			break
+		}
+		if math.IsNaN(x) {
+			return 0, math.NaN()
+		}
+		peak = math.Max(peak, math.Abs(x))
+		n++
+	}
+	return float64(n) / d.rate, peak
+}
+
+func TestVoices(t *testing.T) {
+	for _, rate := range []int{22050, 44100, 96000} {
+		for _, voice := range Voices {
+			d, err := New(DefaultParams(voice), rate, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			length, peak := hit(d)
+			if length <= 0 || length > 1 {
+				t.Errorf("%s at %d Hz: a hit lasts %vs", voice, rate, length)
+			}
+			if !(peak > 0.1 && peak <= 1) {
+				t.Errorf("%s at %d Hz: peak of %v", voice, rate, peak)
+			}
+		}
+	}
+}
+
+func TestDecay(t *testing.T) {
+	for _, voice := range Voices {
+		p := DefaultParams(voice)
+		p.Decay = 0
+		short, _ := New(p, 44100, 0)
+		p.Decay = 1
+		long, _ := New(p, 44100, 0)
+
+		if s, l := short.length, long.length; s >= l {
+			t.Errorf("%s: expected decay to lengthen hits, got %d and %d samples", voice, s, l)
+		}
+	}
+}
+
+func TestHitsRepeat(t *testing.T) {
+	d, _ := New(DefaultParams("snare"), 44100, 0)
+
+	var a, b Voice
+	d.Start(&a)
+	d.Start(&b)
+	for i := 0; i < 1000; i++ {
+		x, _ := d.Next(&a)
+		y, _ := d.Next(&b)
+		if x != y {
+			t.Fatalf("expected hits to sound the same, differed at sample %d", i)
+		}
+	}
+}
+
+func TestUnknownVoice(t *testing.T) {
+	if _, err := New(DefaultParams("gong"), 44100, 0); err == nil {
+		t.Error("expected an error for an unknown voice")
+	}
+}
+
+func TestParamsJSON(t *testing.T) {
+	var p Params
+	if err := json.Unmarshal([]byte(`{"voice": "snare", "snappy": 0.9}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Voice != "snare" || p.Snappy != 0.9 || p.Decay != 0.5 || p.Tone != 0.5 {
+		t.Errorf("expected unset knobs at 0.5, got %+v", p)
+	}
+}
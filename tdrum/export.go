@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/midi"
+	"os"
+)
+
+// export implements "tdrum export", which writes patterns out in other
+// formats rather than playing them.
+func export(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("midi", "", "write a Standard MIDI File to `path`")
+	format := flags.Int("format", 1, "MIDI file format, 0 or 1")
+	notes := midi.DefaultNoteMap()
+	flags.Var(notes, "note", "play the track with `id=note` or name=note (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tdrum export -midi out.mid file.splice [file.splice...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *out == "" || flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	var patterns []*drum.Pattern
+	for _, file := range flags.Args() {
+		pattern, err := drum.DecodeFile(file)
+		if err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+		for _, track := range pattern.Tracks {
+			if _, ok := notes.Note(track); !ok {
+				fmt.Printf("warning: %s: no note for track (%d) %s, leaving it out\n", file, track.ID, track.Name)
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	opts := &midi.Options{Format: *format, Notes: notes}
+	if err := midi.Encode(*out, opts, patterns...); err != nil {
+		fmt.Printf("error: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/midi"
+	"os"
+	"strings"
+)
+
+// importMIDI implements "tdrum import", which turns the drums of a MIDI
+// file into pattern files.
+func importMIDI(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	in := flags.String("midi", "", "read the Standard MIDI File at `path`")
+	beat := flags.Int("beat", 4, "steps per quarter note")
+	length := flags.Int("length", 0, "steps per pattern (default a bar)")
+	notes := midi.DefaultNoteMap()
+	flags.Var(notes, "note", "number the track for a note with `id=note` (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tdrum import -midi in.mid out.splice")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *in == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	opts := &midi.Options{Notes: notes, StepsPerBeat: *beat, Length: *length}
+	patterns, err := midi.DecodeFile(*in, opts)
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		os.Exit(1)
+	}
+
+	// One pattern keeps the name it was given, more are numbered
+	out := flags.Arg(0)
+	for i, pattern := range patterns {
+		path := out
+		if len(patterns) > 1 {
+			path = fmt.Sprintf("%s_%d.splice", strings.TrimSuffix(out, ".splice"), i+1)
+		}
+		if err := drum.Encode(pattern, path); err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(path)
+	}
+}
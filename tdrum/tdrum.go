@@ -1,11 +1,17 @@
 package main
 
 import (
-	"code.google.com/p/portaudio-go/portaudio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/nsf/termbox-go"
 	"github.com/rubyist/drum"
+	"github.com/rubyist/drum/audio"
+	"github.com/rubyist/drum/audio/device"
+	"github.com/rubyist/drum/kit"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -37,7 +43,23 @@ var (
 	timeT  = []rune{'t', 'i', 'm', 'e'}
 )
 
-var sequencer *Sequencer
+var sequencer *audio.Sequencer
+
+// patternFile is the path of the pattern being played.
+var patternFile string
+
+// missingSamples is the number of tracks played without their samples.
+var missingSamples int
+
+// playing is the sequencer's position as of its last event. The draw
+// loop keeps it up to date so that it never reads the sequencer itself.
+var playing audio.Event
+
+// tempo is the tempo set with the + and - keys, 0 until one is pressed.
+var tempo float64
+
+// swing is the swing set with the [ and ] keys, 0 until one is pressed.
+var swing int
 
 func box(column, row, width, height int, fill termbox.Attribute) {
 	// Top left
@@ -157,45 +179,47 @@ func textBox(row, column, width int, title, value string) {
 	termbox.SetCell(col, row, cornerBR, termbox.ColorDefault, background)
 }
 
-func drawSteps(row int, steps []bool) {
-	if len(steps) != 16 {
-		panic("invalid set of steps")
+// stepColumns lays out a pattern's steps against the right edge of a
+// screen w cells wide. It returns the column of the bar line opening
+// each beat and the column of each step.
+func stepColumns(pattern *drum.Pattern, w int) (beats, steps []int) {
+	n, beat := pattern.StepCount(), pattern.BeatSize()
+	groups := (n + beat - 1) / beat
+	col := w - 1 - 2*groups - 2*n
+
+	for i := 0; i < n; i++ {
+		if i%beat == 0 {
+			beats = append(beats, col)
+			col += 2
+		}
+		steps = append(steps, col)
+		col += 2
 	}
+	return beats, steps
+}
 
-	curStep := sequencer.Step
-
-	w, _ := termbox.Size()
-	start := w - 41
-	col := start
-
-	for i := 0; i < 16; i++ {
-		if i%4 == 0 {
-			termbox.SetCell(col, row, vLine, termbox.ColorDefault, tracksBG)
-			col++
+func drawSteps(row int, steps []drum.Step, beats, cols []int) {
+	curStep := playing.Step
 
-			termbox.SetCell(col, row, ' ', termbox.ColorDefault, tracksBG)
-			col++
-		}
+	for _, col := range beats {
+		termbox.SetCell(col, row, vLine, termbox.ColorDefault, tracksBG)
+	}
 
+	for i, col := range cols {
 		bg := termbox.Attribute(tracksBG)
-		if sequencer.Running && i == curStep {
+		if playing.Running && i == curStep {
 			bg = curStepBG
 		}
 
-		if steps[i] {
+		if i < len(steps) && steps[i].Hit() {
 			termbox.SetCell(col, row, hit, hitFG, bg)
-			col++
 		} else {
 			termbox.SetCell(col, row, noHit, termbox.ColorDefault, bg)
-			col++
 		}
-
-		termbox.SetCell(col, row, ' ', termbox.ColorDefault, tracksBG)
-		col++
 	}
 }
 
-func drawTrack(row int, track *drum.Track) {
+func drawTrack(row int, track *drum.Track, beats, cols []int) {
 	col := 1
 
 	termbox.SetCell(col, row, ' ', termbox.ColorDefault, tracksBG)
@@ -221,7 +245,7 @@ func drawTrack(row int, track *drum.Track) {
 		col++
 	}
 
-	drawSteps(row, track.Steps)
+	drawSteps(row, track.Steps, beats, cols)
 }
 
 func draw(pattern *drum.Pattern) {
@@ -229,64 +253,62 @@ func draw(pattern *drum.Pattern) {
 	termbox.Clear(termbox.ColorDefault, background)
 
 	// Name box
-	name := strings.TrimSuffix(filepath.Base(os.Args[1]), ".splice")
-	textBox(0, 0, w-12-10, "name", name)
+	name := strings.TrimSuffix(filepath.Base(patternFile), ".splice")
+	textBox(0, 0, w-12-9-10, "name", name)
+
+	// Tempo box, following any change of tempo as it's heard
+	bpm := float64(pattern.Tempo)
+	if tempo > 0 {
+		bpm = tempo
+	}
+	if playing.Running && playing.Tempo > 0 {
+		bpm = playing.Tempo
+	}
+	textBox(0, w-12-9-10, 10, "tempo", fmt.Sprintf("%.4g", bpm))
 
-	// Tempo box
-	textBox(0, w-12-10, 10, "tempo", fmt.Sprintf("%v", pattern.Tempo))
+	// Swing box
+	percent := pattern.SwingPercent()
+	if swing > 0 {
+		percent = swing
+	}
+	textBox(0, w-12-9, 9, "swing", fmt.Sprintf("%d%%", percent))
 
 	// Time box
 	textBox(0, w-12, 12, "time", time.Now().Format("15:04:05"))
 
 	// Version box?
-	textBox(h-3, 0, w, "", fmt.Sprintf("tDrum v0.0.0 (HW Version %s)", pattern.Version))
+	status := fmt.Sprintf("tDrum v0.0.0 (HW Version %s)", pattern.Version)
+	if missingSamples > 0 {
+		status += fmt.Sprintf(" - %d tracks without samples", missingSamples)
+	}
+	textBox(h-3, 0, w, "", status)
 
 	// Steps outline
 	box(0, 3, w, h-7, tracksBG)
 
 	trackRow := 4
+	beats, cols := stepColumns(pattern, w)
 
 	for _, track := range pattern.Tracks {
-		drawTrack(trackRow, track)
+		drawTrack(trackRow, track, beats, cols)
 		trackRow++
 	}
 
 	// Remaining bar lines
-	termbox.SetCell(6, 3, '\u252c', termbox.ColorDefault, background)
-	termbox.SetCell(w-11, 3, '\u252c', termbox.ColorDefault, background)
-	termbox.SetCell(w-21, 3, '\u252c', termbox.ColorDefault, background)
-	termbox.SetCell(w-31, 3, '\u252c', termbox.ColorDefault, background)
-	termbox.SetCell(w-41, 3, '\u252c', termbox.ColorDefault, background)
-	termbox.SetCell(6, h-4, '\u2534', termbox.ColorDefault, background)
-	termbox.SetCell(w-11, h-4, '\u2534', termbox.ColorDefault, background)
-	termbox.SetCell(w-21, h-4, '\u2534', termbox.ColorDefault, background)
-	termbox.SetCell(w-31, h-4, '\u2534', termbox.ColorDefault, background)
-	termbox.SetCell(w-41, h-4, '\u2534', termbox.ColorDefault, background)
-
-	for r := trackRow; r < h-4; r++ {
-		termbox.SetCell(6, r, vLine, termbox.ColorDefault, tracksBG)
-		termbox.SetCell(w-11, r, vLine, termbox.ColorDefault, tracksBG)
-		termbox.SetCell(w-21, r, vLine, termbox.ColorDefault, tracksBG)
-		termbox.SetCell(w-31, r, vLine, termbox.ColorDefault, tracksBG)
-		termbox.SetCell(w-41, r, vLine, termbox.ColorDefault, tracksBG)
+	lines := append([]int{6}, beats...)
+	for _, c := range lines {
+		termbox.SetCell(c, 3, '\u252c', termbox.ColorDefault, background)
+		termbox.SetCell(c, h-4, '\u2534', termbox.ColorDefault, background)
+		for r := trackRow; r < h-4; r++ {
+			termbox.SetCell(c, r, vLine, termbox.ColorDefault, tracksBG)
+		}
 	}
 
 	// step columns
-	stepCols := []int{
-		w - 39, w - 37, w - 35, w - 33,
-		w - 29, w - 27, w - 25, w - 23,
-		w - 19, w - 17, w - 15, w - 13,
-		w - 9, w - 7, w - 5, w - 3,
-	}
-
-	if sequencer.Running {
-		step := sequencer.Step
+	if playing.Running && playing.Step < len(cols) {
+		c := cols[playing.Step]
 		for r := trackRow; r < h-4; r++ {
-			for i, c := range stepCols {
-				if i == step {
-					termbox.SetCell(c, r, ' ', termbox.ColorDefault, curStepBG)
-				}
-			}
+			termbox.SetCell(c, r, ' ', termbox.ColorDefault, curStepBG)
 		}
 	}
 
@@ -294,39 +316,89 @@ func draw(pattern *drum.Pattern) {
 }
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("usage: tdrum file.splice")
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		export(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importMIDI(os.Args[2:])
+		return
+	}
+
+	kitFile := flag.String("kit", "", "kit file choosing the samples of tracks, instead of sounds/<name>.wav")
+	var sink audio.Sink
+	flag.Var(&sink, "out", "where the pattern is played, device, null or pcm on standard output")
+	var config audio.Config
+	flag.StringVar(&config.Device, "device", "", "name of the sound device to play through, instead of the default")
+	flag.IntVar(&config.Rate, "rate", audio.DefaultRate, "sample rate, in frames per second")
+	flag.IntVar(&config.Channels, "channels", audio.DefaultChannels, "number of channels, 1 for mono")
+	flag.IntVar(&config.Buffer, "buffer", audio.DefaultBuffer, "frames played at a time")
+	flag.DurationVar(&config.Latency, "latency", 0, "output latency asked of the sound device, instead of its default")
+	ramp := flag.Int("ramp", 0, "steps over which the tempo glides to one set with + and -, 0 to change at once")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tdrum [-kit kit.json] [-out device|null|pcm] file.splice")
+		fmt.Fprintln(os.Stderr, "       tdrum export -midi out.mid file.splice [file.splice...]")
+		fmt.Fprintln(os.Stderr, "       tdrum import -midi in.mid out.splice")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
+	patternFile = flag.Arg(0)
 
-	pattern, err := drum.DecodeFile(os.Args[1])
+	pattern, err := drum.DecodeFile(patternFile)
 	if err != nil {
 		fmt.Printf("error: %s\n", err)
 		os.Exit(1)
 	}
 
-	sequencer = NewSequencer()
-	if err := sequencer.Add(pattern); err != nil {
+	k := kit.Default("sounds")
+	if *kitFile != "" {
+		if k, err = kit.Load(*kitFile); err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	sequencer = audio.NewSequencer(&audio.Options{Config: config, Kit: k, Ramp: *ramp})
+	warnings, err := sequencer.Add(pattern)
+	if err != nil {
 		fmt.Printf("error: %s\n", err)
 		os.Exit(1)
 	}
+	missingSamples = len(warnings)
+	for _, w := range warnings {
+		log.Print(w)
+	}
 
-	portaudio.Initialize()
-	defer portaudio.Terminate()
-	stream, err := portaudio.OpenDefaultStream(0, 2, 44100, 0, func(o []int32) {
-		sequencer.Read(o)
-	})
+	var out audio.Output
+	switch sink {
+	case audio.DeviceSink:
+		out, err = device.Open(sequencer.Config())
+	case audio.WAVSink:
+		err = errors.New("tdrum plays live, render wav files with the player")
+	default:
+		out, err = audio.OpenOutput(sink, sequencer.Config(), "", 16)
+	}
 	if err != nil {
-		log.Fatal(err)
+		fmt.Printf("error: %s\n", err)
+		os.Exit(1)
 	}
-	defer stream.Close()
-	stream.Start()
-	defer stream.Stop()
+
+	// Playing stops when quitting, before out is closed
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	played := make(chan error, 1)
+	go func() {
+		played <- sequencer.Play(ctx, out, 0)
+	}()
 
 	if err := termbox.Init(); err != nil {
 		panic(err)
 	}
-	defer termbox.Close()
 	termbox.SetOutputMode(termbox.Output256)
 
 	eq := make(chan termbox.Event)
@@ -337,6 +409,7 @@ func main() {
 	}()
 
 	draw(pattern)
+	var playErr error
 loop:
 	for {
 		select {
@@ -345,15 +418,57 @@ loop:
 				break loop
 			}
 			if ev.Type == termbox.EventKey && ev.Key == termbox.KeySpace {
-				if sequencer.Running {
+				if playing.Running {
 					sequencer.Reset()
 				} else {
 					sequencer.Start()
 				}
 			}
+			if ev.Type == termbox.EventKey && (ev.Ch == '+' || ev.Ch == '=' || ev.Ch == '-') {
+				if tempo == 0 {
+					tempo = float64(pattern.Tempo)
+				}
+				if ev.Ch == '-' {
+					tempo = math.Max(20, tempo-1)
+				} else {
+					tempo = math.Min(300, tempo+1)
+				}
+				sequencer.SetTempo(tempo)
+			}
+			if ev.Type == termbox.EventKey && (ev.Ch == '[' || ev.Ch == ']') {
+				if swing == 0 {
+					swing = pattern.SwingPercent()
+				}
+				if ev.Ch == '[' {
+					swing = max(drum.MinSwing, swing-1)
+				} else {
+					swing = min(drum.MaxSwing, swing+1)
+				}
+				sequencer.SetSwing(swing)
+			}
+		case playing = <-sequencer.Events():
+			draw(pattern)
+		case playErr = <-played:
+			// The output failed, so there's nothing more to hear
+			break loop
 		default:
 			draw(pattern)
 			time.Sleep(time.Millisecond * 2)
 		}
 	}
+	termbox.Close()
+
+	if playErr == nil {
+		stop()
+		if playErr = <-played; playErr == context.Canceled {
+			playErr = nil
+		}
+	}
+	if err := out.Close(); playErr == nil {
+		playErr = err
+	}
+	if playErr != nil {
+		fmt.Printf("error: %s\n", playErr)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,159 @@
+package wav
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	formatFloat      = 3
+	formatExtensible = 0xfffe
+)
+
+// ErrFormat is returned when a file isn't a WAVE file or its samples are
+// in a format that can't be read.
+var ErrFormat = errors.New("wav: unsupported file format")
+
+// Sound holds the samples of a WAVE file.
+type Sound struct {
+	Rate     int // frames per second
+	Channels int
+
+	// Samples holds the interleaved samples of every channel, scaled to
+	// lie between -1 and 1 whatever the file's sample format.
+	Samples []float32
+}
+
+// Frames returns the number of frames, samples of every channel, in s.
+func (s *Sound) Frames() int {
+	if s.Channels == 0 {
+		return 0
+	}
+	return len(s.Samples) / s.Channels
+}
+
+// ReadFile reads the WAVE file found at the provided path.
+func ReadFile(path string) (*Sound, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Read reads a WAVE file from r. Samples may be 8, 16, 24 or 32 bit PCM
+// or 32 bit floating point, with any number of channels and any rate.
+// A data chunk that ends early, as left by recorders that were cut off,
+// is read up to its last whole frame.
+func Read(r io.Reader) (*Sound, error) {
+	br := bufio.NewReader(r)
+
+	var header [12]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, ErrFormat
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, ErrFormat
+	}
+
+	var s *Sound
+	var format, bits int
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(br, chunk[:]); err != nil {
+			return nil, errors.New("wav: no data chunk")
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch id {
+		case "fmt ":
+			var data bytes.Buffer
+			if _, err := io.CopyN(&data, br, size); err != nil || size < 16 {
+				return nil, ErrFormat
+			}
+			f := data.Bytes()
+			format = int(binary.LittleEndian.Uint16(f[0:]))
+			s = &Sound{
+				Channels: int(binary.LittleEndian.Uint16(f[2:])),
+				Rate:     int(binary.LittleEndian.Uint32(f[4:])),
+			}
+			bits = int(binary.LittleEndian.Uint16(f[14:]))
+
+			// The real format of an extensible file starts its sub format GUID
+			if format == formatExtensible {
+				if len(f) < 26 {
+					return nil, ErrFormat
+				}
+				format = int(binary.LittleEndian.Uint16(f[24:]))
+			}
+			if s.Channels == 0 || s.Rate == 0 || !supported(format, bits) {
+				return nil, ErrFormat
+			}
+
+		case "data":
+			if s == nil {
+				return nil, errors.New("wav: data chunk before fmt chunk")
+			}
+			var data bytes.Buffer
+			if _, err := data.ReadFrom(io.LimitReader(br, size)); err != nil {
+				return nil, err
+			}
+			s.Samples = decode(data.Bytes(), format, bits, s.Channels)
+			return s, nil
+
+		default:
+			if _, err := io.CopyN(io.Discard, br, size); err != nil {
+				return nil, errors.New("wav: no data chunk")
+			}
+		}
+
+		// Chunks are padded to an even size
+		if size%2 == 1 {
+			br.ReadByte()
+		}
+	}
+}
+
+func supported(format, bits int) bool {
+	switch format {
+	case formatPCM:
+		return bits == 8 || bits == 16 || bits == 24 || bits == 32
+	case formatFloat:
+		return bits == 32
+	}
+	return false
+}
+
+// decode scales the whole frames of PCM data to floats.
+func decode(data []byte, format, bits, channels int) []float32 {
+	size := bits / 8
+	n := len(data) / (size * channels) * channels
+	samples := make([]float32, n)
+
+	for i := range samples {
+		b := data[i*size:]
+		switch {
+		case format == formatFloat:
+			samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(b))
+		case bits == 8:
+			// 8 bit samples are unsigned
+			samples[i] = float32(int(b[0])-128) / (1 << 7)
+		case bits == 16:
+			samples[i] = float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		case bits == 24:
+			v := int32(b[0])<<8 | int32(b[1])<<16 | int32(b[2])<<24
+			samples[i] = float32(v>>8) / (1 << 23)
+		case bits == 32:
+			samples[i] = float32(float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31))
+		}
+	}
+	return samples
+}
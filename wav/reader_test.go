@@ -0,0 +1,120 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// wave builds a WAVE file with a junk chunk ahead of the data, as many
+// editors write.
+func wave(format, channels, bits int, data []byte) []byte {
+	var buf bytes.Buffer
+	chunk := func(id string, data []byte) {
+		buf.WriteString(id)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+		if len(data)%2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+
+	buf.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	fmtChunk := make([]byte, 16)
+	binary.LittleEndian.PutUint16(fmtChunk[0:], uint16(format))
+	binary.LittleEndian.PutUint16(fmtChunk[2:], uint16(channels))
+	binary.LittleEndian.PutUint32(fmtChunk[4:], 22050)
+	binary.LittleEndian.PutUint16(fmtChunk[14:], uint16(bits))
+	chunk("fmt ", fmtChunk)
+	chunk("junk", []byte{1, 2, 3})
+	chunk("data", data)
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	tData := []struct {
+		name     string
+		format   int
+		channels int
+		bits     int
+		data     []byte
+		samples  []float32
+	}{
+		{"8 bit", formatPCM, 1, 8, []byte{0x80, 0xc0, 0x00}, []float32{0, 0.5, -1}},
+		{"16 bit", formatPCM, 1, 16, []byte{0x00, 0x40, 0x00, 0x80}, []float32{0.5, -1}},
+		{"24 bit", formatPCM, 2, 24, []byte{0x00, 0x00, 0xc0, 0x00, 0x00, 0x40}, []float32{-0.5, 0.5}},
+		{"32 bit", formatPCM, 1, 32, []byte{0x00, 0x00, 0x00, 0x40}, []float32{0.5}},
+		{"float", formatFloat, 1, 32, []byte{0x00, 0x00, 0x80, 0xbe}, []float32{-0.25}},
+		{"partial frame", formatPCM, 2, 16, []byte{0x00, 0x40, 0x00, 0x40, 0x00}, []float32{0.5, 0.5}},
+	}
+
+	for _, exp := range tData {
+		s, err := Read(bytes.NewReader(wave(exp.format, exp.channels, exp.bits, exp.data)))
+		if err != nil {
+			t.Fatalf("%s: %v", exp.name, err)
+		}
+		if s.Rate != 22050 || s.Channels != exp.channels {
+			t.Errorf("%s: got %d Hz, %d channels", exp.name, s.Rate, s.Channels)
+		}
+		if len(s.Samples) != len(exp.samples) {
+			t.Fatalf("%s: expected %v, got %v", exp.name, exp.samples, s.Samples)
+		}
+		for i := range s.Samples {
+			if s.Samples[i] != exp.samples[i] {
+				t.Errorf("%s: expected %v, got %v", exp.name, exp.samples, s.Samples)
+				break
+			}
+		}
+	}
+}
+
+func TestReadUnsupported(t *testing.T) {
+	tData := []struct {
+		name string
+		data []byte
+	}{
+		{"not riff", []byte("RIFX\x00\x00\x00\x00WAVE")},
+		{"12 bit", wave(formatPCM, 1, 12, nil)},
+		{"64 bit float", wave(formatFloat, 1, 64, nil)},
+		{"compressed", wave(2, 1, 4, nil)},
+	}
+
+	for _, exp := range tData {
+		if _, err := Read(bytes.NewReader(exp.data)); err != ErrFormat {
+			t.Errorf("%s: expected ErrFormat, got %v", exp.name, err)
+		}
+	}
+}
+
+func TestReadWriter(t *testing.T) {
+	file, err := ioutil.TempFile("", "wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	w, err := NewWriter(file, 48000, 2, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteInt32([]int32{0x40000000, -0x80000000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	s, err := ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Rate != 48000 || s.Channels != 2 || s.Frames() != 1 {
+		t.Fatalf("got %d Hz, %d channels, %d frames", s.Rate, s.Channels, s.Frames())
+	}
+	if s.Samples[0] != 0.5 || s.Samples[1] != -1 {
+		t.Errorf("got samples %v", s.Samples)
+	}
+}
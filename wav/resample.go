@@ -0,0 +1,137 @@
+package wav
+
+import (
+	"errors"
+	"math"
+)
+
+// Quality selects how Resample computes samples between the original ones.
+type Quality int
+
+const (
+	// Sinc filters with a windowed sinc, which keeps the whole audible
+	// band and filters out what can't be represented at a lower rate.
+	Sinc Quality = iota
+
+	// Linear draws a straight line between neighbouring frames. It's much
+	// faster, but dulls high frequencies and lets them alias when the
+	// rate is lowered.
+	Linear
+)
+
+// String returns the name of q as accepted by Set.
+func (q Quality) String() string {
+	switch q {
+	case Sinc:
+		return "sinc"
+	case Linear:
+		return "linear"
+	}
+	return "unknown"
+}
+
+// Set sets q by name, "sinc" or "linear", so that a Quality can be
+// used as a flag.Value.
+func (q *Quality) Set(name string) error {
+	switch name {
+	case "sinc":
+		*q = Sinc
+	case "linear":
+		*q = Linear
+	default:
+		return errors.New("wav: quality must be sinc or linear")
+	}
+	return nil
+}
+
+const (
+	zeroCrossings = 16  // on each side of the sinc filter's center
+	kernelRes     = 256 // table entries between zero crossings
+)
+
+// kernel holds one side of the windowed sinc filter, which is symmetric.
+var kernel = func() []float64 {
+	k := make([]float64, zeroCrossings*kernelRes+2)
+	k[0] = 1
+	for i := 1; i < len(k); i++ {
+		x := float64(i) / kernelRes
+		if x >= zeroCrossings {
+			break
+		}
+		// Blackman window
+		w := x / zeroCrossings
+		window := 0.42 + 0.5*math.Cos(math.Pi*w) + 0.08*math.Cos(2*math.Pi*w)
+		k[i] = math.Sin(math.Pi*x) / (math.Pi * x) * window
+	}
+	return k
+}()
+
+// sinc returns the filter's value x zero crossings from its center.
+func sinc(x float64) float64 {
+	x = math.Abs(x) * kernelRes
+	i := int(x)
+	if i >= zeroCrossings*kernelRes {
+		return 0
+	}
+	f := x - float64(i)
+	return kernel[i]*(1-f) + kernel[i+1]*f
+}
+
+// Resample returns the sound played at rate frames per second, keeping
+// its pitch and length. The sound itself is returned when it is already
+// at that rate.
+func (s *Sound) Resample(rate int, q Quality) *Sound {
+	if rate == s.Rate || rate <= 0 || s.Rate <= 0 {
+		return s
+	}
+
+	in := s.Frames()
+	ratio := float64(s.Rate) / float64(rate) // input frames per output frame
+	frames := int(math.Ceil(float64(in) / ratio))
+	out := &Sound{
+		Rate:     rate,
+		Channels: s.Channels,
+		Samples:  make([]float32, frames*s.Channels),
+	}
+
+	switch q {
+	case Linear:
+		for i := 0; i < frames; i++ {
+			t := float64(i) * ratio
+			j := int(t)
+			f := float32(t - float64(j))
+			for c := 0; c < s.Channels; c++ {
+				v := s.Samples[j*s.Channels+c] * (1 - f)
+				if j+1 < in {
+					v += s.Samples[(j+1)*s.Channels+c] * f
+				}
+				out.Samples[i*s.Channels+c] = v
+			}
+		}
+
+	default:
+		// When lowering the rate, the filter's cutoff is lowered to the
+		// new Nyquist frequency, which widens it.
+		cutoff := math.Min(1, 1/ratio)
+		radius := zeroCrossings / cutoff
+		acc := make([]float64, s.Channels)
+		for i := 0; i < frames; i++ {
+			t := float64(i) * ratio
+			lo := int(math.Max(0, math.Ceil(t-radius)))
+			hi := int(math.Min(float64(in-1), math.Floor(t+radius)))
+			for c := range acc {
+				acc[c] = 0
+			}
+			for j := lo; j <= hi; j++ {
+				w := sinc((t-float64(j))*cutoff) * cutoff
+				for c := range acc {
+					acc[c] += w * float64(s.Samples[j*s.Channels+c])
+				}
+			}
+			for c, v := range acc {
+				out.Samples[i*s.Channels+c] = float32(v)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package wav
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns a stereo sound of a sine wave at freq Hz.
+func sine(rate, frames int, freq float64) *Sound {
+	s := &Sound{Rate: rate, Channels: 2, Samples: make([]float32, frames*2)}
+	for i := 0; i < frames; i++ {
+		v := float32(0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+		s.Samples[i*2], s.Samples[i*2+1] = v, -v
+	}
+	return s
+}
+
+func TestResample(t *testing.T) {
+	tData := []struct {
+		from, to int
+		quality  Quality
+		maxError float64
+	}{
+		{22050, 44100, Sinc, 0.001},
+		{48000, 44100, Sinc, 0.001},
+		{96000, 44100, Sinc, 0.001},
+		{22050, 44100, Linear, 0.01},
+		{48000, 44100, Linear, 0.01},
+	}
+
+	for _, exp := range tData {
+		s := sine(exp.from, exp.from/10, 1000).Resample(exp.to, exp.quality)
+		want := sine(exp.to, exp.to/10, 1000)
+
+		if s.Rate != exp.to || s.Frames() != want.Frames() {
+			t.Fatalf("%d to %d: got %d frames at %d Hz, expected %d", exp.from, exp.to, s.Frames(), s.Rate, want.Frames())
+		}
+
+		// The ends are left out, where the filter runs off the sound
+		var worst float64
+		for i := 100 * 2; i < len(s.Samples)-100*2; i++ {
+			worst = math.Max(worst, math.Abs(float64(s.Samples[i]-want.Samples[i])))
+		}
+		if worst > exp.maxError {
+			t.Errorf("%d to %d %s: error of %v", exp.from, exp.to, exp.quality, worst)
+		}
+	}
+}
+
+func TestResampleFiltersAliases(t *testing.T) {
+	// 20 kHz can't be represented at 22050 Hz, so it should be filtered out
+	s := sine(44100, 4410, 20000).Resample(22050, Sinc)
+
+	var peak float64
+	for i := 100 * 2; i < len(s.Samples)-100*2; i++ {
+		peak = math.Max(peak, math.Abs(float64(s.Samples[i])))
+	}
+	if peak > 0.01 {
+		t.Errorf("expected 20 kHz to be filtered out, got a peak of %v", peak)
+	}
+}
+
+func TestResampleSameRate(t *testing.T) {
+	s := sine(44100, 100, 1000)
+	if s.Resample(44100, Sinc) != s {
+		t.Error("expected the sound itself at the same rate")
+	}
+}
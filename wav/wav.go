@@ -0,0 +1,9 @@
+// Package wav reads and writes the WAVE audio files used for samples and
+// rendered patterns.
+package wav
+
+const (
+	formatPCM = 1
+
+	headerSize = 44 // RIFF header, fmt chunk and data chunk header
+)
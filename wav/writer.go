@@ -0,0 +1,121 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrTooLong is returned by WriteInt32 when the samples would take the
+// file past the 4GiB that the sizes in its header can describe.
+var ErrTooLong = errors.New("wav: file too long")
+
+// Writer writes PCM samples to a WAVE file. The sizes in the file's
+// header are filled in by Close, so the underlying writer must be able
+// to seek.
+type Writer struct {
+	w        io.WriteSeeker
+	rate     int
+	channels int
+	bits     int
+	frames   int64
+	buf      []byte
+	err      error
+}
+
+// NewWriter writes the header of a WAVE file with the given sample rate,
+// number of channels and bits per sample, which must be 16 or 24, and
+// returns a Writer for its samples.
+func NewWriter(w io.WriteSeeker, rate, channels, bits int) (*Writer, error) {
+	if bits != 16 && bits != 24 {
+		return nil, errors.New("wav: bits per sample must be 16 or 24")
+	}
+	if rate <= 0 || channels <= 0 {
+		return nil, errors.New("wav: invalid sample rate or channel count")
+	}
+
+	wr := &Writer{w: w, rate: rate, channels: channels, bits: bits}
+	if err := wr.writeHeader(); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// WriteInt32 writes interleaved samples scaled to the full range of an
+// int32, keeping the most significant bits that fit the file's sample size.
+// The number of samples should be a multiple of the number of channels.
+func (wr *Writer) WriteInt32(samples []int32) error {
+	if wr.err != nil {
+		return wr.err
+	}
+
+	size := wr.bits / 8
+	frames := wr.frames + int64(len(samples)/wr.channels)
+	if frames*int64(wr.channels*size) > math.MaxUint32-(headerSize-8) {
+		wr.err = ErrTooLong
+		return wr.err
+	}
+	if cap(wr.buf) < len(samples)*size {
+		wr.buf = make([]byte, len(samples)*size)
+	}
+	buf := wr.buf[:len(samples)*size]
+
+	for i, s := range samples {
+		b := buf[i*size:]
+		switch wr.bits {
+		case 16:
+			binary.LittleEndian.PutUint16(b, uint16(s>>16))
+		case 24:
+			b[0], b[1], b[2] = byte(s>>8), byte(s>>16), byte(s>>24)
+		}
+	}
+
+	if _, err := wr.w.Write(buf); err != nil {
+		wr.err = err
+		return err
+	}
+	wr.frames = frames
+	return nil
+}
+
+// Close fills in the sizes in the file's header. It does not close the
+// underlying writer.
+func (wr *Writer) Close() error {
+	if wr.err != nil {
+		return wr.err
+	}
+	if _, err := wr.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := wr.writeHeader(); err != nil {
+		return err
+	}
+	_, err := wr.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (wr *Writer) writeHeader() error {
+	blockAlign := wr.channels * wr.bits / 8
+	dataSize := uint32(wr.frames) * uint32(blockAlign)
+
+	h := make([]byte, headerSize)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], headerSize-8+dataSize)
+	copy(h[8:], "WAVE")
+
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], formatPCM)
+	binary.LittleEndian.PutUint16(h[22:], uint16(wr.channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(wr.rate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(wr.rate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(h[34:], uint16(wr.bits))
+
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], dataSize)
+
+	_, err := wr.w.Write(h)
+	return err
+}
@@ -0,0 +1,90 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	tData := []struct {
+		bits int
+		data []byte
+	}{
+		{16, []byte{0xff, 0x7f, 0x00, 0x80, 0x34, 0x12, 0x00, 0x00}},
+		{24, []byte{0xff, 0xff, 0x7f, 0x00, 0x00, 0x80, 0x56, 0x34, 0x12, 0x00, 0x00, 0x00}},
+	}
+
+	for _, exp := range tData {
+		file, err := ioutil.TempFile("", "wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+
+		w, err := NewWriter(file, 44100, 2, exp.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteInt32([]int32{0x7fffffff, -0x80000000}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteInt32([]int32{0x12345678, 0}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		data, err := ioutil.ReadFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(data) != headerSize+len(exp.data) {
+			t.Fatalf("%d bits: expected %d bytes, got %d", exp.bits, headerSize+len(exp.data), len(data))
+		}
+		if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" || string(data[36:40]) != "data" {
+			t.Fatalf("%d bits: bad header %q", exp.bits, data[:headerSize])
+		}
+		if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+			t.Errorf("%d bits: RIFF size %d, expected %d", exp.bits, size, len(data)-8)
+		}
+		if size := binary.LittleEndian.Uint32(data[40:]); int(size) != len(exp.data) {
+			t.Errorf("%d bits: data size %d, expected %d", exp.bits, size, len(exp.data))
+		}
+		if bits := binary.LittleEndian.Uint16(data[34:]); int(bits) != exp.bits {
+			t.Errorf("%d bits: header says %d bits", exp.bits, bits)
+		}
+		if !bytes.Equal(data[headerSize:], exp.data) {
+			t.Errorf("%d bits: got samples %x, expected %x", exp.bits, data[headerSize:], exp.data)
+		}
+	}
+}
+
+func TestWriterTooLong(t *testing.T) {
+	file, err := ioutil.TempFile("", "wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w, err := NewWriter(file, 44100, 2, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stand in for the hours of audio it takes to fill the file
+	w.frames = (math.MaxUint32 - (headerSize - 8)) / 4
+	if err := w.WriteInt32([]int32{0, 0}); err != ErrTooLong {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+	if err := w.Close(); err != ErrTooLong {
+		t.Errorf("expected Close to report ErrTooLong, got %v", err)
+	}
+}